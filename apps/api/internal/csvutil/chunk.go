@@ -0,0 +1,115 @@
+package csvutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// Chunk is a byte range of a CSV file that holds whole records.
+type Chunk struct {
+	Start int64
+	End   int64
+}
+
+// SplitChunks splits the records between start and end of r into chunks of
+// about size bytes that begin and end on record boundaries. start must itself
+// be a record boundary, such as the end of the header.
+//
+// A newline ends a record only outside quotes. Quotes inside quoted fields are
+// doubled, so a position is inside quotes exactly when an odd number of quotes
+// precede it. The quotes of every chunk are counted on up to workers goroutines
+// and each boundary is then moved forward to the first newline outside quotes.
+func SplitChunks(ctx context.Context, r io.ReaderAt, start, end, size int64, workers int) ([]Chunk, error) {
+	if size <= 0 || end-start <= size {
+		return []Chunk{{Start: start, End: end}}, nil
+	}
+
+	n := int((end - start + size - 1) / size)
+	quotes := make([]int64, n)
+	errs := make([]error, n)
+	next := make(chan int, n)
+	for i := range n {
+		next <- i
+	}
+	close(next)
+
+	var wg sync.WaitGroup
+	for range max(1, min(workers, n)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if errs[i] = ctx.Err(); errs[i] != nil {
+					continue
+				}
+				from := start + int64(i)*size
+				quotes[i], errs[i] = countQuotes(io.NewSectionReader(r, from, min(size, end-from)))
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunks := []Chunk{}
+	from := start
+	var parity int64
+	for i := 1; i < n; i++ {
+		parity += quotes[i-1]
+		nominal := start + int64(i)*size
+		if nominal <= from {
+			continue
+		}
+		boundary, err := nextRecord(r, nominal, end, parity%2 == 1)
+		if err != nil {
+			return nil, err
+		}
+		if boundary > from && boundary < end {
+			chunks = append(chunks, Chunk{Start: from, End: boundary})
+			from = boundary
+		}
+	}
+	return append(chunks, Chunk{Start: from, End: end}), nil
+}
+
+func countQuotes(r io.Reader) (int64, error) {
+	buf := make([]byte, 64*1024)
+	var count int64
+	for {
+		n, err := r.Read(buf)
+		count += int64(bytes.Count(buf[:n], []byte{'"'}))
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// nextRecord returns the offset just past the first newline outside quotes at
+// or after offset, or end when there is none.
+func nextRecord(r io.ReaderAt, offset, end int64, inQuotes bool) (int64, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, offset, end-offset))
+	for pos := offset; ; pos++ {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '\n' && !inQuotes:
+			return pos + 1, nil
+		}
+	}
+}
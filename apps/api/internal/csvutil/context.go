@@ -0,0 +1,15 @@
+package csvutil
+
+import "context"
+
+// CheckInterval is the number of rows read between two checks for
+// cancellation of the context passed to a read loop.
+const CheckInterval = 1000
+
+// checkContext returns ctx's error on every CheckInterval-th row.
+func checkContext(ctx context.Context, rows int) error {
+	if rows%CheckInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
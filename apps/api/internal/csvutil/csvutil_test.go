@@ -1,6 +1,12 @@
 package csvutil
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"math/big"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -21,6 +27,29 @@ func TestInferNumeric(t *testing.T) {
 		}
 	}
 }
+func TestInferDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"1080.00", "1080", true}, {"-1.5e3", "-1500", true}, {"+.5", "1/2", true}, {"1E-2", "1/100", true},
+		{"", "", false}, {"1/3", "", false}, {"1_000", "", false}, {"0x10", "", false}, {"1.2.3", "", false},
+		{"1e", "", false}, {"Inf", "", false}, {"1e40", "10000000000000000000000000000000000000000", true},
+		{"1e999999", "", false}, {"1e-900000", "", false}, {"1e00041", "", false}, {strings.Repeat("9", 41), "", false},
+	}
+	for _, tc := range tests {
+		var val big.Rat
+		ok := InferDecimal(tc.input, &val)
+		if ok != tc.ok {
+			t.Errorf("InferDecimal(%q) ok = %v, want %v", tc.input, ok, tc.ok)
+		}
+		if ok && val.RatString() != tc.expected {
+			t.Errorf("InferDecimal(%q) val = %s, want %s", tc.input, val.RatString(), tc.expected)
+		}
+	}
+}
+
 func TestParseCSV(t *testing.T) {
 	t.Run("Valid CSV", func(t *testing.T) {
 		input := "h1,h2\nv1,v2\nv3,v4"
@@ -56,3 +85,113 @@ func TestParseCSV(t *testing.T) {
 		}
 	})
 }
+func TestCompareColumns(t *testing.T) {
+	missing, extra := CompareColumns([]string{"a", "b", "c"}, []string{"c", "a", "d"})
+	if len(missing) != 1 || missing[0] != "b" {
+		t.Errorf("expected missing [b], got %v", missing)
+	}
+	if len(extra) != 1 || extra[0] != "d" {
+		t.Errorf("expected extra [d], got %v", extra)
+	}
+}
+func TestAppendCSV(t *testing.T) {
+	var out strings.Builder
+	rows, err := AppendCSV(context.Background(), &out, strings.NewReader("a,b\n1,2"), strings.NewReader("b,a\n4,3\n"))
+	if err != nil {
+		t.Fatalf("AppendCSV failed: %v", err)
+	}
+	if rows != 2 {
+		t.Errorf("expected 2 rows, got %d", rows)
+	}
+	if out.String() != "a,b\n1,2\n3,4\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+func TestSortCSV(t *testing.T) {
+	input := "id,name\n3,c\n1,a\n5,e\n2,b\n4,d\n1,a2\n"
+	tmpDir := t.TempDir()
+	sorted, err := SortCSV(context.Background(), strings.NewReader(input), []string{"id"}, 2, tmpDir)
+	if err != nil {
+		t.Fatalf("SortCSV failed: %v", err)
+	}
+
+	var names []string
+	for {
+		row, err := sorted.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, row[1])
+	}
+	if got := strings.Join(names, ","); got != "a,a2,b,c,d,e" {
+		t.Errorf("expected stable key order a,a2,b,c,d,e, got %s", got)
+	}
+
+	if err := sorted.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("expected spill files to be removed, found %d", len(entries))
+	}
+
+	if _, err := SortCSV(context.Background(), strings.NewReader(input), []string{"missing"}, 2, tmpDir); err == nil {
+		t.Error("expected error for missing key column, got nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	large := "id\n" + strings.Repeat("1\n", 2*CheckInterval)
+	if _, err := SortCSV(ctx, strings.NewReader(large), []string{"id"}, 2*CheckInterval, tmpDir); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestIndexRows(t *testing.T) {
+	input := "id,note\n1,a\n2,\"multi\nline\"\n3,c\n4,d\n5,e\n"
+	rows, index, err := IndexRows(context.Background(), strings.NewReader(input), 2)
+	if err != nil {
+		t.Fatalf("IndexRows failed: %v", err)
+	}
+	if rows != 5 || len(index.Offsets) != 3 {
+		t.Fatalf("expected 5 rows and 3 offsets, got %d and %v", rows, index.Offsets)
+	}
+
+	row, offset, ok := index.Seek(3)
+	if !ok || row != 2 {
+		t.Fatalf("expected Seek(3) to start at row 2, got %d", row)
+	}
+	if got := input[offset : offset+4]; got != "3,c\n" {
+		t.Errorf("expected offset of row 3,c, got %q", got)
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	input := "id,note\n1,a\n2,\"multi\nline \"\"quoted\"\"\n\"\n3,c\r\n4,\"x,\ny\"\n5,e\n6,f"
+	want, err := csv.NewReader(strings.NewReader(input)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := int64(strings.Index(input, "\n") + 1)
+	end := int64(len(input))
+
+	for size := int64(1); size <= end; size++ {
+		chunks, err := SplitChunks(context.Background(), strings.NewReader(input), start, end, size, 3)
+		if err != nil {
+			t.Fatalf("SplitChunks(%d) failed: %v", size, err)
+		}
+		got := want[:1]
+		for i, c := range chunks {
+			if (i == 0 && c.Start != start) || (i > 0 && c.Start != chunks[i-1].End) || c.End <= c.Start {
+				t.Fatalf("size %d: chunks do not cover the input: %v", size, chunks)
+			}
+			records, err := csv.NewReader(strings.NewReader(input[c.Start:c.End])).ReadAll()
+			if err != nil {
+				t.Fatalf("size %d: chunk %q is not whole records: %v", size, input[c.Start:c.End], err)
+			}
+			got = append(got, records...)
+		}
+		if chunks[len(chunks)-1].End != end || !reflect.DeepEqual(got, want) {
+			t.Fatalf("size %d: expected %q, got %q", size, want, got)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package csvutil
+
+import (
+	"container/heap"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// SortedRows iterates over CSV data rows in key order. Rows are produced by SortCSV
+// and may be backed by temporary files, so Close must always be called.
+type SortedRows struct {
+	Header []string
+	keyIdx []int
+	files  []*os.File
+	runs   runHeap
+}
+
+// SortCSV sorts the data rows of a CSV by keyColumns without holding the whole file
+// in memory: runs of at most chunkRows rows are sorted and spilled to temporary
+// files in tmpDir (the OS default when empty) and then merged lazily by Next.
+// Keys are compared column by column as plain strings. Reading stops with ctx's
+// error when it is cancelled.
+func SortCSV(ctx context.Context, src io.Reader, keyColumns []string, chunkRows int, tmpDir string) (*SortedRows, error) {
+	csvReader := csv.NewReader(src)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	keyIdx := make([]int, len(keyColumns))
+	for i, k := range keyColumns {
+		keyIdx[i] = slices.Index(header, k)
+		if keyIdx[i] < 0 {
+			return nil, fmt.Errorf("invalid key column: %s", k)
+		}
+	}
+	if chunkRows <= 0 {
+		chunkRows = 50000
+	}
+
+	s := &SortedRows{Header: header, keyIdx: keyIdx}
+	chunk := make([][]string, 0, chunkRows)
+	for rows := 1; ; rows++ {
+		row, err := csvReader.Read()
+		if err == nil {
+			err = checkContext(ctx, rows)
+		}
+		if err != nil && err != io.EOF {
+			s.Close()
+			return nil, err
+		}
+		if row != nil {
+			chunk = append(chunk, row)
+		}
+		if len(chunk) == chunkRows || (err == io.EOF && len(chunk) > 0) {
+			if spillErr := s.spill(chunk, tmpDir); spillErr != nil {
+				s.Close()
+				return nil, spillErr
+			}
+			chunk = chunk[:0]
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	for _, f := range s.files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			s.Close()
+			return nil, err
+		}
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		run := &sortRun{reader: r, seq: len(s.runs.items)}
+		if err := run.advance(); err != nil {
+			s.Close()
+			return nil, err
+		}
+		if run.row != nil {
+			s.runs.items = append(s.runs.items, run)
+		}
+	}
+	s.runs.compare = s.Compare
+	heap.Init(&s.runs)
+	return s, nil
+}
+
+func (s *SortedRows) spill(chunk [][]string, tmpDir string) error {
+	slices.SortStableFunc(chunk, s.Compare)
+
+	f, err := os.CreateTemp(tmpDir, "csvsort-*.csv")
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, f)
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(chunk); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Key returns the key fields of row.
+func (s *SortedRows) Key(row []string) []string {
+	key := make([]string, len(s.keyIdx))
+	for i, idx := range s.keyIdx {
+		if idx < len(row) {
+			key[i] = row[idx]
+		}
+	}
+	return key
+}
+
+// Compare orders two rows by their key fields.
+func (s *SortedRows) Compare(a, b []string) int {
+	for _, idx := range s.keyIdx {
+		var av, bv string
+		if idx < len(a) {
+			av = a[idx]
+		}
+		if idx < len(b) {
+			bv = b[idx]
+		}
+		if c := strings.Compare(av, bv); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Next returns the next row in key order, or io.EOF when all rows were returned.
+func (s *SortedRows) Next() ([]string, error) {
+	if s.runs.Len() == 0 {
+		return nil, io.EOF
+	}
+	run := s.runs.items[0]
+	row := run.row
+	if err := run.advance(); err != nil {
+		return nil, err
+	}
+	if run.row == nil {
+		heap.Pop(&s.runs)
+	} else {
+		heap.Fix(&s.runs, 0)
+	}
+	return row, nil
+}
+
+// Close removes the temporary files backing the sorted rows.
+func (s *SortedRows) Close() error {
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.Close())
+		if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	s.files = nil
+	return errors.Join(errs...)
+}
+
+// sortRun is one sorted spill file being merged; row is nil once it is exhausted.
+// seq orders runs with equal keys so that the merge is stable.
+type sortRun struct {
+	reader *csv.Reader
+	row    []string
+	seq    int
+}
+
+func (r *sortRun) advance() error {
+	row, err := r.reader.Read()
+	if err == io.EOF {
+		r.row = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.row = row
+	return nil
+}
+
+type runHeap struct {
+	items   []*sortRun
+	compare func(a, b []string) int
+}
+
+func (h runHeap) Len() int { return len(h.items) }
+func (h runHeap) Less(i, j int) bool {
+	if c := h.compare(h.items[i].row, h.items[j].row); c != 0 {
+		return c < 0
+	}
+	return h.items[i].seq < h.items[j].seq
+}
+func (h runHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *runHeap) Push(x any)   { h.items = append(h.items, x.(*sortRun)) }
+func (h *runHeap) Pop() any {
+	old := h.items
+	item := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return item
+}
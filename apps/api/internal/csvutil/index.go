@@ -0,0 +1,62 @@
+package csvutil
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+)
+
+// DefaultIndexStride is the number of data rows between two entries of a
+// RowIndex built at upload time.
+const DefaultIndexStride = 1000
+
+// RowIndex is a sparse index of the byte offsets at which data rows start.
+// Offsets[i] is the offset of data row i*Stride, so reading can resume near any
+// row without rescanning the file. Offsets account for quoted newlines.
+type RowIndex struct {
+	Stride  int
+	Offsets []int64
+}
+
+// Seek returns the indexed position closest to, but not after, the given
+// 0-based data row: the row number found and its byte offset. It reports false
+// when the index has no entry to start from.
+func (idx *RowIndex) Seek(row int) (int, int64, bool) {
+	if idx == nil || idx.Stride <= 0 || len(idx.Offsets) == 0 || row < 0 {
+		return 0, 0, false
+	}
+	i := min(row/idx.Stride, len(idx.Offsets)-1)
+	return i * idx.Stride, idx.Offsets[i], true
+}
+
+// IndexRows reads a CSV file, counting its data rows and recording the offset of
+// every stride-th row.
+func IndexRows(ctx context.Context, reader io.Reader, stride int) (int, RowIndex, error) {
+	index := RowIndex{Stride: stride}
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	if _, err := csvReader.Read(); err != nil {
+		return 0, index, err
+	}
+
+	rows := 0
+	for {
+		offset := csvReader.InputOffset()
+		_, err := csvReader.Read()
+		if err == io.EOF {
+			return rows, index, nil
+		}
+		if err != nil {
+			return rows, index, err
+		}
+		if rows%stride == 0 {
+			index.Offsets = append(index.Offsets, offset)
+		}
+		rows++
+		if err := checkContext(ctx, rows); err != nil {
+			return rows, index, err
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package csvutil
 
-import "strconv"
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
 
 // InferNumeric attempts to parse a string value as a 64-bit floating point number.
 func InferNumeric(valStr string) (float64, bool) {
@@ -10,3 +14,63 @@ func InferNumeric(valStr string) (float64, bool) {
 	}
 	return val, true
 }
+
+// Bounds of the decimals InferDecimal accepts. Larger mantissas and exponents
+// are not amounts, and parsing them exactly costs time and memory that grow
+// with their size.
+const (
+	MaxDecimalDigits   = 40
+	MaxDecimalExponent = 40
+)
+
+// InferDecimal parses a decimal string such as "1080.00" or "-1.5e3" exactly into
+// dst. Unlike InferNumeric it never rounds, so sums of amounts stay exact to the
+// cent. Values with more than MaxDecimalDigits digits or an exponent beyond
+// MaxDecimalExponent are rejected.
+func InferDecimal(valStr string, dst *big.Rat) bool {
+	if !boundedDecimal(valStr) {
+		return false
+	}
+	_, ok := dst.SetString(valStr)
+	return ok
+}
+
+// boundedDecimal reports whether s is a plain decimal within the bounds of
+// InferDecimal: an optional sign, digits with at most one decimal point and an
+// optional exponent.
+func boundedDecimal(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	digits, dot := 0, false
+	i := 0
+	for ; i < len(s); i++ {
+		if c := s[i]; c >= '0' && c <= '9' {
+			digits++
+		} else if c == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+	}
+	if digits == 0 || digits > MaxDecimalDigits {
+		return false
+	}
+	if i == len(s) {
+		return true
+	}
+	if s[i] != 'e' && s[i] != 'E' {
+		return false
+	}
+	exp := s[i+1:]
+	if exp != "" && (exp[0] == '+' || exp[0] == '-') {
+		exp = exp[1:]
+	}
+	// Reject long exponents before converting, so leading zeros are the only
+	// way past the length check and still parse within bounds.
+	if exp == "" || len(exp) > 4 || strings.Trim(exp, "0123456789") != "" {
+		return false
+	}
+	n, _ := strconv.Atoi(exp)
+	return n <= MaxDecimalExponent
+}
@@ -0,0 +1,122 @@
+package csvutil
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"slices"
+)
+
+// CountRows reads a CSV file and returns the number of data rows after the header.
+func CountRows(ctx context.Context, reader io.Reader) (int, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	if _, err := csvReader.Read(); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for {
+		_, err := csvReader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows++
+		if err := checkContext(ctx, rows); err != nil {
+			return rows, err
+		}
+	}
+}
+
+// CompareColumns reports which base columns are missing from next and which
+// columns in next are not present in base. Column order is ignored.
+func CompareColumns(base, next []string) (missing, extra []string) {
+	for _, c := range base {
+		if !slices.Contains(next, c) {
+			missing = append(missing, c)
+		}
+	}
+	for _, c := range next {
+		if !slices.Contains(base, c) {
+			extra = append(extra, c)
+		}
+	}
+	return missing, extra
+}
+
+// AppendCSV writes the records of base followed by the data rows of extra to dst.
+// Rows from extra are reordered to match the base header, so both inputs must
+// contain the same set of columns. It returns the number of data rows written.
+func AppendCSV(ctx context.Context, dst io.Writer, base, extra io.Reader) (int, error) {
+	baseReader := csv.NewReader(base)
+	baseReader.FieldsPerRecord = -1
+	extraReader := csv.NewReader(extra)
+	extraReader.FieldsPerRecord = -1
+	csvWriter := csv.NewWriter(dst)
+
+	headers, err := baseReader.Read()
+	if err != nil {
+		return 0, err
+	}
+	extraHeaders, err := extraReader.Read()
+	if err != nil {
+		return 0, err
+	}
+	if err := csvWriter.Write(headers); err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for {
+		row, err := baseReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		if err := csvWriter.Write(row); err != nil {
+			return rows, err
+		}
+		rows++
+		if err := checkContext(ctx, rows); err != nil {
+			return rows, err
+		}
+	}
+
+	positions := make([]int, len(headers))
+	for i, h := range headers {
+		positions[i] = slices.Index(extraHeaders, h)
+	}
+	out := make([]string, len(headers))
+	for {
+		row, err := extraReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		for i, pos := range positions {
+			out[i] = ""
+			if pos >= 0 && pos < len(row) {
+				out[i] = row[pos]
+			}
+		}
+		if err := csvWriter.Write(out); err != nil {
+			return rows, err
+		}
+		rows++
+		if err := checkContext(ctx, rows); err != nil {
+			return rows, err
+		}
+	}
+
+	csvWriter.Flush()
+	return rows, csvWriter.Error()
+}
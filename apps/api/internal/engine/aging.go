@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAgingBuckets are the upper bounds, in days past due, of the standard
+// 1-30, 31-60 and 61-90 aging buckets.
+var DefaultAgingBuckets = []int{30, 60, 90}
+
+// DefaultExcludedStatuses lists invoice statuses that do not represent a receivable.
+var DefaultExcludedStatuses = []string{"Draft", "Cancelled", "Void"}
+
+// AgingRequest configures an accounts receivable aging analysis. Column names
+// default to those of the bundled invoice sample.
+type AgingRequest struct {
+	// AsOf is the YYYY-MM-DD date balances are aged at. Defaults to today.
+	AsOf string `json:"asOf"`
+	// Buckets are ascending upper bounds in days past due. Invoices not yet due
+	// are "current" and invoices beyond the last bound fall into an open-ended bucket.
+	Buckets []int `json:"buckets"`
+	// Columns maps invoice fields to dataset columns.
+	Columns AgingColumns `json:"columns"`
+	// ExcludeStatuses lists invoice statuses that are not receivable.
+	// Defaults to Draft, Cancelled and Void.
+	ExcludeStatuses []string `json:"excludeStatuses"`
+}
+
+// AgingColumns maps invoice fields to dataset columns. Customer, DueDate, Total
+// and Status default to the columns of the bundled invoice sample. Paid and
+// InvoiceDate default to the "paid_amount" and "invoice_date" columns when the
+// dataset has them. NoPaid opts out of paid amounts, so nothing counts as paid,
+// and NoInvoiceDate ages every invoice regardless of its issue date.
+type AgingColumns struct {
+	Customer      string `json:"customer"`
+	InvoiceDate   string `json:"invoiceDate"`
+	DueDate       string `json:"dueDate"`
+	Total         string `json:"total"`
+	Paid          string `json:"paid"`
+	Status        string `json:"status"`
+	NoPaid        bool   `json:"noPaid"`
+	NoInvoiceDate bool   `json:"noInvoiceDate"`
+}
+
+// AgingResponse lists outstanding balances per customer and bucket, largest first.
+type AgingResponse struct {
+	AsOf    string     `json:"asOf"`
+	Buckets []string   `json:"buckets"`
+	Rows    []AgingRow `json:"rows"`
+	Totals  AgingRow   `json:"totals"`
+}
+
+// AgingRow is the outstanding balance of one customer, split by bucket.
+type AgingRow struct {
+	Customer string   `json:"customer"`
+	Invoices int      `json:"invoices"`
+	Buckets  []string `json:"buckets"`
+	Total    string   `json:"total"`
+}
+
+type agingTotals struct {
+	customer string
+	invoices int
+	buckets  []*big.Rat
+	total    *big.Rat
+}
+
+func newAgingTotals(customer string, buckets int) *agingTotals {
+	t := &agingTotals{customer: customer, buckets: make([]*big.Rat, buckets), total: new(big.Rat)}
+	for i := range t.buckets {
+		t.buckets[i] = new(big.Rat)
+	}
+	return t
+}
+
+// agingThreshold is the outstanding amount up to which an invoice counts as settled.
+var agingThreshold = big.NewRat(5, 1000)
+
+// RunAging computes the outstanding balance of every open invoice as of a date and
+// buckets it by days past due. Invoices issued after the as-of date are ignored.
+func RunAging(ctx context.Context, filePath string, req AgingRequest) (AgingResponse, error) {
+	asOf := time.Now().UTC().Truncate(24 * time.Hour)
+	if req.AsOf != "" {
+		var ok bool
+		if asOf, ok = parseDate(req.AsOf); !ok {
+			return AgingResponse{}, fmt.Errorf("invalid asOf date: %s", req.AsOf)
+		}
+	}
+
+	bounds := req.Buckets
+	if len(bounds) == 0 {
+		bounds = DefaultAgingBuckets
+	}
+	for i, b := range bounds {
+		if b < 1 || (i > 0 && b <= bounds[i-1]) {
+			return AgingResponse{}, fmt.Errorf("invalid buckets: bounds must be positive and ascending")
+		}
+	}
+	labels := agingLabels(bounds)
+
+	excluded := req.ExcludeStatuses
+	if excluded == nil {
+		excluded = DefaultExcludedStatuses
+	}
+
+	c := req.Columns
+	headers, err := readHeader(filePath)
+	if err != nil {
+		return AgingResponse{}, err
+	}
+	// Empty Paid and InvoiceDate columns read as empty values: nothing paid and
+	// no issue date.
+	columns := []string{
+		defaultString(c.Customer, "customer_name"),
+		optionalColumn(headers, c.InvoiceDate, "invoice_date", c.NoInvoiceDate),
+		defaultString(c.DueDate, "due_date"),
+		defaultString(c.Total, "total"),
+		optionalColumn(headers, c.Paid, "paid_amount", c.NoPaid),
+		defaultString(c.Status, "status"),
+	}
+
+	byCustomer := make(map[string]*agingTotals)
+	var order []*agingTotals
+	totals := newAgingTotals("", len(labels))
+
+	_, err = forEachRow(ctx, filePath, columns, nil, func(v []string) error {
+		if hasStatus(excluded, v[5]) {
+			return nil
+		}
+		if issued, ok := parseDate(v[1]); ok && issued.After(asOf) {
+			return nil
+		}
+		outstanding := parseAmount(v[3])
+		outstanding.Sub(outstanding, parseAmount(v[4]))
+		if outstanding.Cmp(agingThreshold) <= 0 {
+			return nil
+		}
+		due, ok := parseDate(v[2])
+		if !ok {
+			due = asOf
+		}
+
+		bucket := agingBucket(daysBetween(due, asOf), bounds)
+		ct, ok := byCustomer[v[0]]
+		if !ok {
+			ct = newAgingTotals(v[0], len(labels))
+			byCustomer[v[0]] = ct
+			order = append(order, ct)
+		}
+		for _, t := range []*agingTotals{ct, totals} {
+			t.invoices++
+			t.buckets[bucket].Add(t.buckets[bucket], outstanding)
+			t.total.Add(t.total, outstanding)
+		}
+		return nil
+	})
+	if err != nil {
+		return AgingResponse{}, err
+	}
+
+	slices.SortStableFunc(order, func(a, b *agingTotals) int {
+		if c := b.total.Cmp(a.total); c != 0 {
+			return c
+		}
+		return strings.Compare(a.customer, b.customer)
+	})
+
+	resp := AgingResponse{
+		AsOf:    asOf.Format("2006-01-02"),
+		Buckets: labels,
+		Rows:    make([]AgingRow, 0, len(order)),
+		Totals:  totals.row(),
+	}
+	for _, ct := range order {
+		resp.Rows = append(resp.Rows, ct.row())
+	}
+	return resp, nil
+}
+
+func (t *agingTotals) row() AgingRow {
+	row := AgingRow{Customer: t.customer, Invoices: t.invoices, Total: formatAmount(t.total)}
+	for _, b := range t.buckets {
+		row.Buckets = append(row.Buckets, formatAmount(b))
+	}
+	return row
+}
+
+// optionalColumn returns the column of an optional field: col when it is set,
+// otherwise def when the dataset has it, and none when the caller opted out.
+func optionalColumn(headers []string, col, def string, optOut bool) string {
+	switch {
+	case optOut:
+		return ""
+	case col != "":
+		return col
+	case slices.Contains(headers, def):
+		return def
+	}
+	return ""
+}
+
+func hasStatus(statuses []string, status string) bool {
+	return slices.ContainsFunc(statuses, func(s string) bool { return strings.EqualFold(s, status) })
+}
+
+// agingBucket returns the bucket index for a number of days past due, where index
+// 0 is "current".
+func agingBucket(daysPastDue int, bounds []int) int {
+	if daysPastDue <= 0 {
+		return 0
+	}
+	for i, b := range bounds {
+		if daysPastDue <= b {
+			return i + 1
+		}
+	}
+	return len(bounds) + 1
+}
+
+func agingLabels(bounds []int) []string {
+	labels := []string{"current"}
+	lower := 1
+	for _, b := range bounds {
+		labels = append(labels, fmt.Sprintf("%d-%d", lower, b))
+		lower = b + 1
+	}
+	return append(labels, strconv.Itoa(bounds[len(bounds)-1])+"+")
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAging(t *testing.T) {
+	csvContent := `customer_name,invoice_date,due_date,status,total,paid_amount
+Acme,2026-01-01,2026-03-01,Sent,100.00,0.00
+Acme,2026-01-01,2026-02-20,Sent,200.00,50.00
+Acme,2026-01-01,2026-01-15,Overdue,300.00,0.00
+Globex,2025-10-01,2025-11-01,Overdue,1000.00,0.00
+Globex,2026-01-01,2026-01-31,Paid,500.00,500.00
+Initech,2026-01-01,2026-01-31,Cancelled,999.00,0.00
+Initech,2026-03-05,2026-04-05,Sent,10.00,
+`
+	csvPath := filepath.Join(t.TempDir(), "invoices.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("default buckets", func(t *testing.T) {
+		resp, err := RunAging(context.Background(), csvPath, AgingRequest{AsOf: "2026-03-01"})
+		if err != nil {
+			t.Fatalf("RunAging failed: %v", err)
+		}
+		wantLabels := []string{"current", "1-30", "31-60", "61-90", "90+"}
+		for i, l := range wantLabels {
+			if resp.Buckets[i] != l {
+				t.Errorf("expected bucket %d to be %s, got %s", i, l, resp.Buckets[i])
+			}
+		}
+		if len(resp.Rows) != 2 {
+			t.Fatalf("expected 2 customers, got %+v", resp.Rows)
+		}
+
+		globex := resp.Rows[0]
+		if globex.Customer != "Globex" || globex.Buckets[4] != "1000.00" || globex.Invoices != 1 {
+			t.Errorf("unexpected Globex row: %+v", globex)
+		}
+		acme := resp.Rows[1]
+		wantAcme := []string{"100.00", "150.00", "300.00", "0.00", "0.00"}
+		for i, v := range wantAcme {
+			if acme.Buckets[i] != v {
+				t.Errorf("expected Acme bucket %s = %s, got %s", wantLabels[i], v, acme.Buckets[i])
+			}
+		}
+		if resp.Totals.Total != "1550.00" || resp.Totals.Invoices != 4 {
+			t.Errorf("unexpected totals: %+v", resp.Totals)
+		}
+	})
+
+	t.Run("custom buckets", func(t *testing.T) {
+		resp, err := RunAging(context.Background(), csvPath, AgingRequest{AsOf: "2026-03-01", Buckets: []int{45}})
+		if err != nil {
+			t.Fatalf("RunAging failed: %v", err)
+		}
+		if len(resp.Buckets) != 3 || resp.Buckets[1] != "1-45" || resp.Buckets[2] != "45+" {
+			t.Errorf("unexpected labels: %v", resp.Buckets)
+		}
+		if resp.Totals.Buckets[1] != "450.00" {
+			t.Errorf("expected 450.00 in 1-45, got %s", resp.Totals.Buckets[1])
+		}
+	})
+
+	t.Run("without paid and invoice date columns", func(t *testing.T) {
+		bare := filepath.Join(t.TempDir(), "bare.csv")
+		if err := os.WriteFile(bare, []byte("customer_name,due_date,status,total\nAcme,2026-02-20,Sent,200.00\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := RunAging(context.Background(), bare, AgingRequest{AsOf: "2026-03-01"})
+		if err != nil {
+			t.Fatalf("RunAging failed: %v", err)
+		}
+		if resp.Totals.Total != "200.00" || resp.Totals.Buckets[1] != "200.00" {
+			t.Errorf("expected the whole total outstanding in 1-30, got %+v", resp.Totals)
+		}
+	})
+
+	t.Run("partial mapping keeps paid and invoice date", func(t *testing.T) {
+		renamed := filepath.Join(t.TempDir(), "renamed.csv")
+		if err := os.WriteFile(renamed, []byte(strings.Replace(csvContent, "customer_name", "client", 1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := RunAging(context.Background(), renamed, AgingRequest{AsOf: "2026-03-01", Columns: AgingColumns{Customer: "client"}})
+		if err != nil {
+			t.Fatalf("RunAging failed: %v", err)
+		}
+		if resp.Totals.Total != "1550.00" || resp.Totals.Invoices != 4 {
+			t.Errorf("expected paid amounts and issue dates to apply, got %+v", resp.Totals)
+		}
+	})
+
+	t.Run("explicit opt out of paid and invoice date", func(t *testing.T) {
+		resp, err := RunAging(context.Background(), csvPath, AgingRequest{AsOf: "2026-03-01", Columns: AgingColumns{NoPaid: true, NoInvoiceDate: true}})
+		if err != nil {
+			t.Fatalf("RunAging failed: %v", err)
+		}
+		// Paid amounts are ignored, and Initech's invoice issued after asOf counts.
+		if resp.Totals.Total != "2110.00" || resp.Totals.Invoices != 6 {
+			t.Errorf("unexpected totals: %+v", resp.Totals)
+		}
+	})
+
+	t.Run("exact amounts", func(t *testing.T) {
+		exact := filepath.Join(t.TempDir(), "exact.csv")
+		content := "customer_name,due_date,status,total,paid_amount\nAcme,2026-02-20,Sent,1.005,0\nGlobex,2026-02-20,Sent,0.3,0.295\n"
+		if err := os.WriteFile(exact, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := RunAging(context.Background(), exact, AgingRequest{AsOf: "2026-03-01"})
+		if err != nil {
+			t.Fatalf("RunAging failed: %v", err)
+		}
+		// 0.3 - 0.295 is exactly the settlement threshold, and 1.005 rounds up.
+		if resp.Totals.Total != "1.01" || resp.Totals.Invoices != 1 {
+			t.Errorf("unexpected totals: %+v", resp.Totals)
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		for _, req := range []AgingRequest{
+			{AsOf: "yesterday"},
+			{Buckets: []int{60, 30}},
+			{Columns: AgingColumns{Total: "amount"}},
+		} {
+			if _, err := RunAging(context.Background(), csvPath, req); err == nil {
+				t.Errorf("expected error for %+v, got nil", req)
+			}
+		}
+	})
+}
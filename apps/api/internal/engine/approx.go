@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Approximation describes the accuracy of a report run with Approximate set.
+type Approximation struct {
+	// SampleRate is the fraction of rows sampled, 1 when every row was read.
+	SampleRate float64 `json:"sampleRate"`
+	// SampleSize is the effective sample size: the rows that were aggregated.
+	SampleSize int `json:"sampleSize"`
+	// Errors holds the error bound of every metric whose values are estimates,
+	// the largest over all groups.
+	Errors []ErrorBound `json:"errors"`
+}
+
+// ErrorBound is the expected error of one metric column. RelativeError is the
+// relative standard error of a count, sum, avg or count_distinct: about 95% of
+// estimates fall within twice it of the true value. RankError bounds the rank
+// of a median or percentile with 99% confidence: the value returned for
+// quantile q lies between the true quantiles q-RankError and q+RankError.
+type ErrorBound struct {
+	Metric        string  `json:"metric"`
+	RelativeError float64 `json:"relativeError,omitempty"`
+	RankError     float64 `json:"rankError,omitempty"`
+}
+
+// compileApproximation validates the approximate options of a request and sets
+// up its metrics for them. It returns the sample rate, 1 when every row is
+// aggregated.
+func compileApproximation(req ReportRequest, metrics []metricInfo) (float64, error) {
+	rate := req.SampleRate
+	if rate == 0 {
+		rate = 1
+	}
+	if !(rate > 0 && rate <= 1) {
+		return 0, fmt.Errorf("invalid sample rate: %v, must be greater than 0 and at most 1", req.SampleRate)
+	}
+	if rate < 1 && !req.Approximate {
+		return 0, fmt.Errorf("invalid sample rate: sampling needs approximate")
+	}
+
+	// Scale by the exact inverse of the decimal rate, 10 for 0.1.
+	var weight *big.Rat
+	if rate < 1 {
+		weight, _ = new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+		weight.Inv(weight)
+	}
+	for i := range metrics {
+		m := &metrics[i]
+		// The distinct values of a sample say little about those of the file,
+		// as values seen once are mostly left out, so no bound applies.
+		if m.op == "count_distinct" && rate < 1 {
+			return 0, fmt.Errorf("invalid metric: %s cannot be estimated from a sample, leave out sampleRate", m.name())
+		}
+		m.approximate = req.Approximate
+		m.sampled = rate < 1
+		if m.op == "count" || m.op == "sum" {
+			m.weight = weight
+		}
+	}
+	return rate, nil
+}
+
+// sampleThreshold returns the row hash below which rows are in a sample of the
+// given rate, or zero when every row is aggregated.
+func sampleThreshold(rate float64) uint64 {
+	if rate >= 1 {
+		return 0
+	}
+	return max(1, uint64(math.Ldexp(rate, 64)))
+}
+
+// sampled reports whether the record ending at byte offset end of its file is
+// in the sample of a threshold. Records are picked by a hash of their position
+// rather than their content, so that identical records are sampled
+// independently, and a file gives the same sample on every run and whether it
+// is scanned sequentially, in parallel or from its column cache.
+func sampled(end int64, threshold uint64) bool {
+	return mix64(uint64(end)+0x9e3779b97f4a7c15) < threshold
+}
+
+// keepsValues reports whether the metric keeps every distinct value or amount,
+// which approximate reports sketch instead.
+func (m metricInfo) keepsValues() bool {
+	switch m.op {
+	case "count_distinct", "median", "percentile":
+		return !m.approximate
+	}
+	return false
+}
+
+// approximation returns the accuracy of an approximate report.
+func (a *aggregation) approximation(rate float64) *Approximation {
+	approx := &Approximation{SampleRate: rate, SampleSize: a.sampled, Errors: []ErrorBound{}}
+	for i, m := range a.metrics {
+		bound := ErrorBound{Metric: m.name()}
+		for _, groupKey := range a.groupOrder {
+			st := &a.results[groupKey][i]
+			bound.RelativeError = max(bound.RelativeError, m.relativeError(st, rate))
+			bound.RankError = max(bound.RankError, m.rankError(st, rate))
+		}
+		if bound.RelativeError > 0 || bound.RankError > 0 {
+			approx.Errors = append(approx.Errors, bound)
+		}
+	}
+	return approx
+}
+
+// relativeError returns the relative standard error of the metric of one group,
+// or zero when it is exact or undefined. The count, sum and average of a sample
+// are unbiased estimates whose variance follows from the sampled amounts.
+// count_distinct, which is never sampled, has the error of its sketch.
+func (m metricInfo) relativeError(st *aggState, rate float64) float64 {
+	if m.op == "count_distinct" {
+		if st.hll != nil && st.hll.registers != nil {
+			return hllStdError
+		}
+		return 0
+	}
+	if rate >= 1 || st.count == 0 {
+		return 0
+	}
+	k := float64(st.count)
+	switch m.op {
+	case "count":
+		return math.Sqrt((1 - rate) / k)
+	case "sum":
+		sum, _ := st.sum.Float64()
+		if sum == 0 {
+			return 0
+		}
+		return math.Sqrt((1-rate)*st.sumSq) / math.Abs(sum)
+	case "avg":
+		sum, _ := st.sum.Float64()
+		mean := sum / k
+		if mean == 0 {
+			return 0
+		}
+		variance := max(0, st.sumSq/k-mean*mean)
+		return math.Sqrt((1-rate)*variance/k) / math.Abs(mean)
+	}
+	return 0
+}
+
+// rankError returns the rank error of the median or percentile of one group:
+// that of its sketch once it compacted values, plus that of the sample, from
+// the Dvoretzky-Kiefer-Wolfowitz inequality.
+func (m metricInfo) rankError(st *aggState, rate float64) float64 {
+	if m.quantile == nil || st.count == 0 {
+		return 0
+	}
+	var e float64
+	if st.kll != nil && st.kll.compacted() {
+		e = kllRankError
+	}
+	if rate < 1 {
+		e += math.Sqrt((1 - rate) * math.Log(2/0.01) / (2 * float64(st.count)))
+	}
+	return e
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	var whole, left, right hyperLogLog
+	const n = 100000
+	for i := range n {
+		x := hashString("customer-" + strconv.Itoa(i))
+		whole.add(x)
+		if i%2 == 0 {
+			left.add(x)
+		} else {
+			right.add(x)
+		}
+	}
+	if got := whole.estimate(); math.Abs(float64(got)-n)/n > 3*hllStdError {
+		t.Errorf("estimate %d is off by more than three standard errors from %d", got, n)
+	}
+	left.merge(&right)
+	if left.estimate() != whole.estimate() {
+		t.Errorf("merged estimate %d differs from %d", left.estimate(), whole.estimate())
+	}
+
+	var small hyperLogLog
+	for i := range 300 {
+		small.add(hashString(strconv.Itoa(i % 100)))
+	}
+	if small.estimate() != 100 || small.registers != nil {
+		t.Errorf("expected a sparse sketch to count 100 exactly, got %d", small.estimate())
+	}
+}
+
+func TestKLLSketch(t *testing.T) {
+	var whole, left, right kllSketch
+	const n = 100000
+	for i := range n {
+		// A permutation of 0..n-1, so that values do not arrive sorted.
+		x := float64(i * 7919 % n)
+		whole.add(x)
+		if i < n/3 {
+			left.add(x)
+		} else {
+			right.add(x)
+		}
+	}
+	left.merge(&right)
+	for _, q := range []float64{0, 0.01, 0.5, 0.9, 0.99, 1} {
+		for name, s := range map[string]*kllSketch{"whole": &whole, "merged": &left} {
+			if got := s.quantile(q); math.Abs(got/n-q) > kllRankError {
+				t.Errorf("%s: quantile %v is %v, rank error above %v", name, q, got, kllRankError)
+			}
+		}
+	}
+	if whole.bytes() > 8*4*kllK {
+		t.Errorf("expected bounded memory, sketch holds %d bytes", whole.bytes())
+	}
+}
+
+func TestApproximateReport(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("id,region,customer,amount\n")
+	const n = 20000
+	for i := range n {
+		fmt.Fprintf(&sb, "%d,%s,cust-%d,%d.50\n", i, []string{"north", "south"}[i%2], i%100, i)
+	}
+	csvPath := filepath.Join(t.TempDir(), "invoices.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p90 := 90.0
+	metrics := []Metric{
+		{Op: "count"},
+		{Op: "sum", Field: "amount"},
+		{Op: "count_distinct", Field: "id"},
+		{Op: "count_distinct", Field: "customer"},
+		{Op: "median", Field: "amount"},
+		{Op: "percentile", Field: "amount", Percentile: &p90},
+	}
+	cell := func(t *testing.T, resp ReportResponse, col string) float64 {
+		t.Helper()
+		for i, c := range resp.Columns {
+			if c == col {
+				v, err := strconv.ParseFloat(resp.Rows[0][i], 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return v
+			}
+		}
+		t.Fatalf("no column %s in %v", col, resp.Columns)
+		return 0
+	}
+
+	t.Run("exact", func(t *testing.T) {
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{Metrics: metrics})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		want := []string{"20000", "200000000.00", "20000", "100", "10000.00", "17999.60"}
+		if strings.Join(resp.Rows[0], ",") != strings.Join(want, ",") {
+			t.Errorf("expected %v, got %v", want, resp.Rows[0])
+		}
+		if resp.Approximation != nil || resp.Columns[5] != "percentile(amount,90)" {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("sketches", func(t *testing.T) {
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{Metrics: metrics, Approximate: true})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		a := resp.Approximation
+		if a == nil || a.SampleRate != 1 || a.SampleSize != n {
+			t.Fatalf("unexpected approximation %+v", a)
+		}
+		if resp.Rows[0][0] != "20000" || resp.Rows[0][3] != "100" {
+			t.Errorf("expected exact counts without sampling, got %v", resp.Rows[0])
+		}
+		if got := cell(t, resp, "count_distinct(id)"); math.Abs(got-n)/n > 3*hllStdError {
+			t.Errorf("distinct ids %v too far from %d", got, n)
+		}
+		if got := cell(t, resp, "median(amount)"); math.Abs(got/n-0.5) > kllRankError {
+			t.Errorf("median %v outside the rank error", got)
+		}
+		bounds := map[string]ErrorBound{}
+		for _, b := range a.Errors {
+			bounds[b.Metric] = b
+		}
+		if len(bounds) != 3 || bounds["count_distinct(id)"].RelativeError != hllStdError || bounds["percentile(amount,90)"].RankError != kllRankError {
+			t.Errorf("unexpected error bounds %+v", a.Errors)
+		}
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		req := ReportRequest{GroupBy: []string{"region"}, Metrics: metrics[:2], Approximate: true, SampleRate: 0.25}
+		resp, err := RunReport(context.Background(), csvPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		a := resp.Approximation
+		if a.SampleRate != 0.25 || math.Abs(float64(a.SampleSize)-n/4) > 4*math.Sqrt(n*0.25*0.75) {
+			t.Fatalf("unexpected sample %+v", a)
+		}
+		if len(a.Errors) != 2 || a.Errors[0].Metric != "count" {
+			t.Fatalf("unexpected error bounds %+v", a.Errors)
+		}
+		for _, row := range resp.Rows {
+			count, _ := strconv.ParseFloat(row[1], 64)
+			if math.Abs(count-n/2)/(n/2) > 4*a.Errors[0].RelativeError {
+				t.Errorf("%s: scaled count %v too far from %d", row[0], count, n/2)
+			}
+			sum, _ := strconv.ParseFloat(row[2], 64)
+			if math.Abs(sum-1e8)/1e8 > 4*a.Errors[1].RelativeError {
+				t.Errorf("%s: scaled sum %v too far from 1e8", row[0], sum)
+			}
+		}
+
+		again, err := RunReport(context.Background(), csvPath, req)
+		if err != nil || strings.Join(again.Rows[0], ",") != strings.Join(resp.Rows[0], ",") {
+			t.Errorf("expected the same sample on every run, got %v and %v", resp.Rows, again.Rows)
+		}
+	})
+
+	t.Run("same sample for every scan", func(t *testing.T) {
+		defer func(w int, size int64) { ScanWorkers, ScanChunkBytes = w, size }(ScanWorkers, ScanChunkBytes)
+		// Identical records are sampled independently of each other.
+		dupPath := filepath.Join(t.TempDir(), "duplicates.csv")
+		if err := os.WriteFile(dupPath, []byte("amount\n"+strings.Repeat("1\n", n)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		req := ReportRequest{Metrics: []Metric{{Op: "count"}}, Approximate: true, SampleRate: 0.5}
+		var samples []int
+		for _, scan := range []func(){
+			func() { ScanWorkers = 1 },
+			func() { ScanWorkers, ScanChunkBytes = 4, 4096 },
+			func() {
+				if err := BuildColumnCache(context.Background(), dupPath); err != nil {
+					t.Fatal(err)
+				}
+			},
+		} {
+			scan()
+			resp, err := RunReport(context.Background(), dupPath, req)
+			if err != nil {
+				t.Fatalf("RunReport failed: %v", err)
+			}
+			samples = append(samples, resp.Approximation.SampleSize)
+		}
+		if samples[0] != samples[1] || samples[0] != samples[2] {
+			t.Errorf("expected the same sample sequentially, in parallel and from the cache, got %v", samples)
+		}
+		if math.Abs(float64(samples[0])-n/2) > 4*math.Sqrt(n*0.25) {
+			t.Errorf("expected about half of the identical records, got %d", samples[0])
+		}
+	})
+
+	for name, req := range map[string]ReportRequest{
+		"sampling without approximate": {Metrics: metrics, SampleRate: 0.5},
+		"sample rate above one":        {Metrics: metrics, Approximate: true, SampleRate: 1.5},
+		"sampled count_distinct":       {Metrics: metrics, Approximate: true, SampleRate: 0.5},
+		"percentile without a value":   {Metrics: []Metric{{Op: "percentile", Field: "amount"}}},
+		"median without a field":       {Metrics: []Metric{{Op: "median"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := RunReport(context.Background(), csvPath, req); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("expected an invalid request error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// CohortRequest configures a retention analysis. Customers are assigned to the
+// cohort of the period they were first seen in, and each later period counts the
+// cohort's customers that were active in it.
+type CohortRequest struct {
+	CustomerField string `json:"customerField"`
+	DateField     string `json:"dateField"`
+	// ValueField optionally adds revenue retention, e.g. "mrr" or "total".
+	ValueField string `json:"valueField,omitempty"`
+	// Grain is the cohort and period size: "week", "month" (default) or "quarter".
+	Grain   string   `json:"grain"`
+	Filters []Filter `json:"filters"`
+}
+
+// CohortResponse is the cohort × period-offset retention matrix. Each cohort has
+// one entry per period from its start up to the last period in the data.
+type CohortResponse struct {
+	Grain   string      `json:"grain"`
+	Periods int         `json:"periods"`
+	Cohorts []CohortRow `json:"cohorts"`
+}
+
+// CohortRow holds one cohort's retention by period offset. Percentages are
+// relative to offset 0. Revenue fields are only set when a value field is given.
+type CohortRow struct {
+	Cohort      string   `json:"cohort"`
+	Size        int      `json:"size"`
+	Customers   []int    `json:"customers"`
+	CustomerPct []string `json:"customerPct"`
+	Revenue     []string `json:"revenue,omitempty"`
+	RevenuePct  []string `json:"revenuePct,omitempty"`
+}
+
+// RunCohorts builds a customer and revenue retention matrix by signup cohort.
+// Rows without a valid date are ignored.
+func RunCohorts(ctx context.Context, filePath string, req CohortRequest) (CohortResponse, error) {
+	grain := defaultString(req.Grain, GrainMonth)
+	switch grain {
+	case GrainWeek, GrainMonth, GrainQuarter:
+	default:
+		return CohortResponse{}, fmt.Errorf("invalid grain: %s", grain)
+	}
+	if req.CustomerField == "" || req.DateField == "" {
+		return CohortResponse{}, fmt.Errorf("invalid cohort request: customerField and dateField are required")
+	}
+
+	activity := make(map[string]map[time.Time]*big.Rat)
+	var last time.Time
+	columns := []string{req.CustomerField, req.DateField, req.ValueField}
+	_, err := forEachRow(ctx, filePath, columns, req.Filters, func(v []string) error {
+		date, ok := parseDate(v[1])
+		if !ok {
+			return nil
+		}
+		period := truncateDate(date, grain)
+		if period.After(last) {
+			last = period
+		}
+		periods, ok := activity[v[0]]
+		if !ok {
+			periods = make(map[time.Time]*big.Rat)
+			activity[v[0]] = periods
+		}
+		value, ok := periods[period]
+		if !ok {
+			value = new(big.Rat)
+			periods[period] = value
+		}
+		value.Add(value, parseAmount(v[2]))
+		return nil
+	})
+	if err != nil {
+		return CohortResponse{}, err
+	}
+
+	type cohortAcc struct {
+		customers []int
+		revenue   []big.Rat
+	}
+	// Revenue sums are exact, so they do not depend on the map order customers
+	// are visited in.
+	cohorts := make(map[time.Time]*cohortAcc)
+	for _, periods := range activity {
+		first := slices.MinFunc(slices.Collect(maps.Keys(periods)), time.Time.Compare)
+		acc, ok := cohorts[first]
+		if !ok {
+			n := periodOffset(first, last, grain) + 1
+			acc = &cohortAcc{customers: make([]int, n), revenue: make([]big.Rat, n)}
+			cohorts[first] = acc
+		}
+		for p, value := range periods {
+			offset := periodOffset(first, p, grain)
+			acc.customers[offset]++
+			acc.revenue[offset].Add(&acc.revenue[offset], value)
+		}
+	}
+
+	starts := slices.SortedFunc(maps.Keys(cohorts), time.Time.Compare)
+	resp := CohortResponse{Grain: grain, Cohorts: []CohortRow{}}
+	for _, start := range starts {
+		acc := cohorts[start]
+		row := CohortRow{Cohort: periodLabel(start, grain), Size: acc.customers[0], Customers: acc.customers}
+		for i := range acc.customers {
+			row.CustomerPct = append(row.CustomerPct, formatPercent(big.NewRat(int64(acc.customers[i]), 1), big.NewRat(int64(acc.customers[0]), 1)))
+			if req.ValueField != "" {
+				row.Revenue = append(row.Revenue, formatAmount(&acc.revenue[i]))
+				row.RevenuePct = append(row.RevenuePct, formatPercent(&acc.revenue[i], &acc.revenue[0]))
+			}
+		}
+		resp.Periods = max(resp.Periods, len(acc.customers))
+		resp.Cohorts = append(resp.Cohorts, row)
+	}
+	return resp, nil
+}
+
+// periodOffset returns how many periods of the grain lie between two period starts.
+func periodOffset(from, to time.Time, grain string) int {
+	switch grain {
+	case GrainWeek:
+		return daysBetween(from, to) / 7
+	case GrainQuarter:
+		return ((to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())) / 3
+	}
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+func formatPercent(part, whole *big.Rat) string {
+	if whole.Sign() == 0 {
+		return "0.00"
+	}
+	return percentOf(part, whole, 2, RoundHalfUp)
+}
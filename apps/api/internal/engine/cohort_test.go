@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunCohorts(t *testing.T) {
+	csvContent := `customer,date,amount,country
+a,2026-01-03,100,US
+b,2026-01-20,50,US
+a,2026-02-01,100,US
+a,2026-03-15,120,US
+b,2026-03-02,60,US
+c,2026-02-11,10,UK
+c,2026-02-12,15,UK
+d,2026-02-28,40,US
+c,2026-03-30,not-a-number,UK
+e,bad-date,1,US
+`
+	csvPath := filepath.Join(t.TempDir(), "activity.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := RunCohorts(context.Background(), csvPath, CohortRequest{CustomerField: "customer", DateField: "date", ValueField: "amount"})
+	if err != nil {
+		t.Fatalf("RunCohorts failed: %v", err)
+	}
+	if resp.Periods != 3 || len(resp.Cohorts) != 2 {
+		t.Fatalf("expected 2 cohorts over 3 periods, got %+v", resp)
+	}
+
+	jan := resp.Cohorts[0]
+	if jan.Cohort != "2026-01" || jan.Size != 2 {
+		t.Errorf("unexpected January cohort: %+v", jan)
+	}
+	wantCustomers := []int{2, 1, 2}
+	wantPct := []string{"100.00", "50.00", "100.00"}
+	wantRevenue := []string{"150.00", "100.00", "180.00"}
+	for i := range wantCustomers {
+		if jan.Customers[i] != wantCustomers[i] || jan.CustomerPct[i] != wantPct[i] || jan.Revenue[i] != wantRevenue[i] {
+			t.Errorf("offset %d: expected %d (%s%%) %s, got %d (%s%%) %s", i,
+				wantCustomers[i], wantPct[i], wantRevenue[i], jan.Customers[i], jan.CustomerPct[i], jan.Revenue[i])
+		}
+	}
+	if jan.RevenuePct[2] != "120.00" {
+		t.Errorf("expected revenue retention 120.00 at offset 2, got %s", jan.RevenuePct[2])
+	}
+
+	feb := resp.Cohorts[1]
+	if feb.Size != 2 || len(feb.Customers) != 2 || feb.Customers[1] != 1 {
+		t.Errorf("unexpected February cohort: %+v", feb)
+	}
+
+	t.Run("filters and no value field", func(t *testing.T) {
+		resp, err := RunCohorts(context.Background(), csvPath, CohortRequest{
+			CustomerField: "customer", DateField: "date", Grain: GrainQuarter,
+			Filters: []Filter{{Field: "country", Op: "eq", Value: "US"}},
+		})
+		if err != nil {
+			t.Fatalf("RunCohorts failed: %v", err)
+		}
+		if len(resp.Cohorts) != 1 || resp.Cohorts[0].Cohort != "2026-Q1" || resp.Cohorts[0].Size != 3 {
+			t.Errorf("unexpected cohorts: %+v", resp.Cohorts)
+		}
+		if resp.Cohorts[0].Revenue != nil {
+			t.Errorf("expected no revenue without value field, got %v", resp.Cohorts[0].Revenue)
+		}
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		for _, req := range []CohortRequest{
+			{CustomerField: "customer"},
+			{CustomerField: "customer", DateField: "date", Grain: "decade"},
+			{CustomerField: "nope", DateField: "date"},
+		} {
+			if _, err := RunCohorts(context.Background(), csvPath, req); err == nil {
+				t.Errorf("expected error for %+v, got nil", req)
+			}
+		}
+	})
+}
@@ -0,0 +1,408 @@
+package engine
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// columnCacheVersion is bumped whenever the layout of columnTable changes, so
+// caches written by older builds are ignored.
+const columnCacheVersion = 2
+
+// maxCacheScale bounds the decimal places of a numeric vector, so that every
+// value fits an int64 once scaled.
+const maxCacheScale = 18
+
+// ColumnCachePath returns the path of the column cache of a CSV file.
+func ColumnCachePath(csvPath string) string {
+	return csvPath + ".colcache"
+}
+
+// columnTable is the parsed content of a CSV file, stored column by column.
+// Size and ModTime identify the version of the file it was built from.
+type columnTable struct {
+	Version int
+	Size    int64
+	ModTime int64
+	Header  []string
+	Rows    int
+	// Lengths holds the field count of every record when some record is shorter
+	// than the header, and is nil otherwise.
+	Lengths []uint32
+	// Ends holds the byte offset of the end of every record, which picks the
+	// records of a sample.
+	Ends    []int64
+	Columns []columnVector
+}
+
+// columnVector holds one column. Every value is dictionary encoded; numeric and
+// date columns also have typed vectors. A column is numeric or a date column
+// when each of its non-empty values is.
+type columnVector struct {
+	Dict  []string
+	Codes []uint32
+	// Nulls has bit i set when record i has no value in the column, that is an
+	// empty or missing field.
+	Nulls []uint64
+	// Nums holds the values scaled by 10^Scale, for numeric columns.
+	Nums  []int64
+	Scale int
+	// Dates holds the values as days since 1970-01-01, for date columns.
+	Dates []int32
+}
+
+func (c *columnVector) null(row int) bool {
+	return c.Nulls[row/64]&(1<<(row%64)) != 0
+}
+
+// BuildColumnCache parses a CSV file once and writes its column cache next to
+// it, where RunReport picks it up.
+func BuildColumnCache(ctx context.Context, csvPath string) error {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read csv headers: %w", err)
+	}
+
+	t := &columnTable{
+		Version: columnCacheVersion,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Header:  append([]string(nil), header...),
+		Columns: make([]columnVector, len(header)),
+	}
+	dicts := make([]map[string]uint32, len(header))
+	for i := range dicts {
+		dicts[i] = make(map[string]uint32)
+	}
+	var lengths []uint32
+	short := false
+	for {
+		// Like a report scan, stop at EOF or the first malformed record.
+		record, err := r.Read()
+		if err != nil {
+			break
+		}
+		row := t.Rows
+		t.Rows++
+		if err := checkContext(ctx, t.Rows); err != nil {
+			return err
+		}
+
+		lengths = append(lengths, uint32(len(record)))
+		t.Ends = append(t.Ends, r.InputOffset())
+		short = short || len(record) < len(header)
+		for c := range t.Columns {
+			col := &t.Columns[c]
+			if row%64 == 0 {
+				col.Nulls = append(col.Nulls, 0)
+			}
+			value := ""
+			if c < len(record) {
+				value = record[c]
+			}
+			if value == "" {
+				col.Nulls[row/64] |= 1 << (row % 64)
+			}
+			code, ok := dicts[c][value]
+			if !ok {
+				code = uint32(len(col.Dict))
+				dicts[c][value] = code
+				col.Dict = append(col.Dict, value)
+			}
+			col.Codes = append(col.Codes, code)
+		}
+	}
+	if short {
+		t.Lengths = lengths
+	}
+	for c := range t.Columns {
+		if err := t.Columns[c].typeValues(ctx); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(csvPath), filepath.Base(csvPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(t); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ColumnCachePath(csvPath))
+}
+
+// typeValues adds the numeric and date vectors of a column whose non-empty
+// values all parse. Values are parsed once per dictionary entry.
+func (c *columnVector) typeValues(ctx context.Context) error {
+	nums := make([]*big.Rat, len(c.Dict))
+	dates := make([]int32, len(c.Dict))
+	numeric, dated := true, true
+	for code, value := range c.Dict {
+		if err := checkContext(ctx, code); err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		if numeric {
+			nums[code] = new(big.Rat)
+			numeric = csvutil.InferDecimal(value, nums[code])
+		}
+		if dated {
+			d, ok := parseDate(value)
+			dates[code] = epochDay(d)
+			dated = ok
+		}
+	}
+
+	if numeric {
+		if scaled, scale, ok := scaleDecimals(nums); ok {
+			c.Nums = make([]int64, len(c.Codes))
+			for row, code := range c.Codes {
+				c.Nums[row] = scaled[code]
+			}
+			c.Scale = scale
+		}
+	}
+	if dated {
+		c.Dates = make([]int32, len(c.Codes))
+		for row, code := range c.Codes {
+			c.Dates[row] = dates[code]
+		}
+	}
+	return nil
+}
+
+// scaleDecimals returns the values as integers scaled by 10^scale, with the
+// smallest scale that represents all of them exactly. It reports false when
+// none up to maxCacheScale does or a scaled value overflows an int64. Nil
+// values are scaled to zero.
+func scaleDecimals(values []*big.Rat) ([]int64, int, bool) {
+	scale := 0
+	pow := big.NewInt(1)
+	rem := new(big.Int)
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for rem.Mod(pow, v.Denom()).Sign() != 0 {
+			if scale == maxCacheScale {
+				return nil, 0, false
+			}
+			scale++
+			pow.Mul(pow, big.NewInt(10))
+		}
+	}
+
+	scaled := make([]int64, len(values))
+	n := new(big.Int)
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		n.Mul(v.Num(), pow)
+		n.Quo(n, v.Denom())
+		if !n.IsInt64() {
+			return nil, 0, false
+		}
+		scaled[i] = n.Int64()
+	}
+	return scaled, scale, true
+}
+
+// MaxLoadedColumnTables is the number of decoded column caches kept in memory,
+// so that consecutive reports on one upload decode its cache only once.
+var MaxLoadedColumnTables = 4
+
+var (
+	// loadedTables holds the decoded column caches, least recently used first.
+	// Tables are never modified once decoded, so reports share them.
+	loadedTables []loadedTable
+	// loadedMu protects loadedTables.
+	loadedMu sync.Mutex
+)
+
+type loadedTable struct {
+	csvPath string
+	table   *columnTable
+}
+
+// loadColumnCache returns the column cache of a CSV file, decoding it unless it
+// is in memory already. It returns nil when there is none, it does not match
+// the current file or ctx is done, and the CSV must be read instead.
+func loadColumnCache(ctx context.Context, csvPath string) *columnTable {
+	info, err := os.Stat(csvPath)
+	if err != nil {
+		return nil
+	}
+	current := func(t *columnTable) bool {
+		return t.Version == columnCacheVersion && t.Size == info.Size() && t.ModTime == info.ModTime().UnixNano()
+	}
+
+	loadedMu.Lock()
+	for i, l := range loadedTables {
+		if l.csvPath != csvPath {
+			continue
+		}
+		loadedTables = slices.Delete(loadedTables, i, i+1)
+		if current(l.table) {
+			loadedTables = append(loadedTables, l)
+			loadedMu.Unlock()
+			return l.table
+		}
+		break
+	}
+	loadedMu.Unlock()
+
+	// Decoding cannot be interrupted, so do not start it for a query that is
+	// already over.
+	if contextError(ctx) != nil {
+		return nil
+	}
+	f, err := os.Open(ColumnCachePath(csvPath))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var t columnTable
+	if err := gob.NewDecoder(f).Decode(&t); err != nil || !current(&t) {
+		return nil
+	}
+
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	forgetColumnTable(csvPath)
+	loadedTables = append(loadedTables, loadedTable{csvPath: csvPath, table: &t})
+	if len(loadedTables) > MaxLoadedColumnTables {
+		loadedTables = slices.Delete(loadedTables, 0, len(loadedTables)-MaxLoadedColumnTables)
+	}
+	return &t
+}
+
+// forgetColumnTable drops the decoded column cache of a CSV file from memory.
+// The caller holds loadedMu.
+func forgetColumnTable(csvPath string) {
+	loadedTables = slices.DeleteFunc(loadedTables, func(l loadedTable) bool { return l.csvPath == csvPath })
+}
+
+// columnCursor reads the records of a column table in order. It implements
+// recordReader and typedValues.
+type columnCursor struct {
+	t      *columnTable
+	row    int
+	record []string
+	scales []*big.Int
+	num    big.Int
+}
+
+func newColumnCursor(t *columnTable) *columnCursor {
+	c := &columnCursor{t: t, row: -1, record: make([]string, len(t.Header)), scales: make([]*big.Int, len(t.Columns))}
+	for i, col := range t.Columns {
+		if col.Nums != nil {
+			c.scales[i] = new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(col.Scale)), nil)
+		}
+	}
+	return c
+}
+
+// Read returns the next record. The returned slice is reused by the next call.
+func (c *columnCursor) Read() ([]string, error) {
+	if c.row+1 >= c.t.Rows {
+		return nil, io.EOF
+	}
+	c.row++
+	width := len(c.t.Header)
+	if c.t.Lengths != nil {
+		width = min(width, int(c.t.Lengths[c.row]))
+	}
+	record := c.record[:width]
+	for i := range record {
+		col := &c.t.Columns[i]
+		record[i] = col.Dict[col.Codes[c.row]]
+	}
+	return record, nil
+}
+
+func (c *columnCursor) InputOffset() int64 {
+	if c.row < 0 {
+		return 0
+	}
+	return c.t.Ends[c.row]
+}
+
+func (c *columnCursor) decimal(col int, dst *big.Rat) (ok, known bool) {
+	if col < 0 || col >= len(c.t.Columns) || c.t.Columns[col].Nums == nil {
+		return false, false
+	}
+	v := &c.t.Columns[col]
+	if v.null(c.row) {
+		return false, true
+	}
+	dst.SetFrac(c.num.SetInt64(v.Nums[c.row]), c.scales[col])
+	return true, true
+}
+
+func (c *columnCursor) date(col int) (t time.Time, ok, known bool) {
+	if col < 0 || col >= len(c.t.Columns) || c.t.Columns[col].Dates == nil {
+		return time.Time{}, false, false
+	}
+	v := &c.t.Columns[col]
+	if v.null(c.row) {
+		return time.Time{}, false, true
+	}
+	return time.Unix(int64(v.Dates[c.row])*secondsPerDay, 0).UTC(), true, true
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+// epochDay returns the day of t counted from 1970-01-01, rounding down so that
+// times before 1970 fall on their own day rather than the one after.
+func epochDay(t time.Time) int32 {
+	secs := t.Unix()
+	day := secs / secondsPerDay
+	if secs%secondsPerDay < 0 {
+		day--
+	}
+	return int32(day)
+}
+
+// RemoveColumnCache deletes the column cache of a CSV file, if any.
+func RemoveColumnCache(csvPath string) error {
+	loadedMu.Lock()
+	forgetColumnTable(csvPath)
+	loadedMu.Unlock()
+	if err := os.Remove(ColumnCachePath(csvPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
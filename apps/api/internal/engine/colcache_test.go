@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestColumnCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	fxPath := filepath.Join(tmpDir, "fx.csv")
+	if err := os.WriteFile(fxPath, []byte("date,from,to,rate\n2026-01-01,EUR,USD,1.10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	csvContent := `id,date,customer,currency,amount,note
+1,2026-01-05,acme,USD,100.50,a
+2,2026-01-20,beta,EUR,20,"multi
+line"
+3,2026-02-03,acme,EUR,0.125,
+4,,beta,USD,,x
+5,2026-03-15,gamma,USD,1e3,y
+6,2026-03-16,acme
+7,2026-04-01,beta,USD,-3.5,z
+`
+	csvPath := filepath.Join(tmpDir, "invoices.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildColumnCache(context.Background(), csvPath); err != nil {
+		t.Fatalf("BuildColumnCache failed: %v", err)
+	}
+
+	table := loadColumnCache(context.Background(), csvPath)
+	if table == nil {
+		t.Fatal("expected a current column cache")
+	}
+	if loadColumnCache(context.Background(), csvPath) != table {
+		t.Error("expected the decoded cache to be reused")
+	}
+	if table.Rows != 7 || table.Lengths == nil {
+		t.Errorf("expected 7 rows with record lengths, got %d rows", table.Rows)
+	}
+	typed := func(name string) (bool, bool) {
+		col := table.Columns[indexHeaders(table.Header)[name]]
+		return col.Nums != nil, col.Dates != nil
+	}
+	if numeric, _ := typed("amount"); !numeric {
+		t.Error("expected a numeric vector for amount")
+	}
+	if _, dated := typed("date"); !dated {
+		t.Error("expected a date vector for date")
+	}
+	if numeric, dated := typed("customer"); numeric || dated {
+		t.Error("expected customer to be dictionary encoded only")
+	}
+
+	requests := map[string]ReportRequest{
+		"sum and avg": {
+			GroupBy: []string{"customer"},
+			Metrics: []Metric{{Op: "count"}, {Op: "sum", Field: "amount", Scale: new(int)}, {Op: "avg", Field: "amount"}},
+			Filters: []Filter{{Field: "note", Op: "neq", Value: "x"}},
+		},
+		"time bucket": {
+			GroupBy:    []string{"date"},
+			Metrics:    []Metric{{Op: "sum", Field: "amount"}},
+			TimeBucket: &TimeBucket{Field: "date", Grain: GrainMonth, FillGaps: true},
+		},
+		"currency": {
+			GroupBy:  []string{"currency"},
+			Metrics:  []Metric{{Op: "sum", Field: "amount"}},
+			Currency: &CurrencyConversion{FXPath: fxPath, Target: "USD"},
+		},
+		"join": {
+			GroupBy: []string{"c.customer"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
+			Joins: []Join{{
+				FilePath: csvPath, Type: JoinLeft, Prefix: "c.",
+				On: []JoinKey{{Left: "id", Right: "id"}},
+			}},
+		},
+	}
+	for name, req := range requests {
+		t.Run(name, func(t *testing.T) {
+			cached, err := RunReport(context.Background(), csvPath, req)
+			if err != nil {
+				t.Fatalf("RunReport failed: %v", err)
+			}
+			if err := RemoveColumnCache(csvPath); err != nil {
+				t.Fatal(err)
+			}
+			defer BuildColumnCache(context.Background(), csvPath)
+			parsed, err := RunReport(context.Background(), csvPath, req)
+			if err != nil {
+				t.Fatalf("RunReport failed: %v", err)
+			}
+			if !reflect.DeepEqual(cached, parsed) {
+				t.Errorf("cached result differs from the CSV:\n got %v\nwant %v", cached, parsed)
+			}
+		})
+	}
+
+	t.Run("not decoded for a cancelled query", func(t *testing.T) {
+		if err := RemoveColumnCache(csvPath); err != nil {
+			t.Fatal(err)
+		}
+		defer BuildColumnCache(context.Background(), csvPath)
+		if err := BuildColumnCache(context.Background(), csvPath); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if loadColumnCache(ctx, csvPath) != nil {
+			t.Error("expected no cache for a cancelled query")
+		}
+	})
+
+	t.Run("stale cache falls back to the csv", func(t *testing.T) {
+		later := time.Now().Add(time.Minute)
+		if err := os.WriteFile(csvPath, []byte(csvContent+"8,2026-04-02,acme,USD,1,n\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(csvPath, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if loadColumnCache(context.Background(), csvPath) != nil {
+			t.Fatal("expected the cache of the old file to be ignored")
+		}
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{Metrics: []Metric{{Op: "count"}}})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		if resp.RowsScanned != 8 {
+			t.Errorf("expected 8 rows from the csv, got %d", resp.RowsScanned)
+		}
+	})
+}
+
+func TestEpochDay(t *testing.T) {
+	for _, s := range []string{"1969-12-31", "1900-02-28", "1970-01-01", "2026-03-15"} {
+		d, _ := parseDate(s)
+		for _, at := range []time.Time{d, d.Add(23 * time.Hour)} {
+			if got := time.Unix(int64(epochDay(at))*secondsPerDay, 0).UTC(); !got.Equal(d) {
+				t.Errorf("epochDay(%v) is the day of %v, want %s", at, got, s)
+			}
+		}
+	}
+}
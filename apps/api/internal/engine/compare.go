@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// Group statuses reported by CompareReports.
+const (
+	CompareAdded     = "added"
+	CompareRemoved   = "removed"
+	CompareChanged   = "changed"
+	CompareUnchanged = "unchanged"
+)
+
+// DateRange bounds a date column inclusively. Either side may be left empty.
+type DateRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Filters returns the filters restricting field to the range.
+func (r DateRange) Filters(field string) []Filter {
+	var filters []Filter
+	if r.From != "" {
+		filters = append(filters, Filter{Field: field, Op: "gte", Value: r.From})
+	}
+	if r.To != "" {
+		filters = append(filters, Filter{Field: field, Op: "lte", Value: r.To})
+	}
+	return filters
+}
+
+// CompareResponse holds the per-group differences between two runs of one report.
+type CompareResponse struct {
+	GroupBy            []string     `json:"groupBy"`
+	Metrics            []string     `json:"metrics"`
+	Rows               []CompareRow `json:"rows"`
+	BaseRowsScanned    int          `json:"baseRowsScanned"`
+	CompareRowsScanned int          `json:"compareRowsScanned"`
+}
+
+// CompareRow describes how one group changed. Status is one of CompareAdded,
+// CompareRemoved, CompareChanged or CompareUnchanged.
+type CompareRow struct {
+	Group  []string       `json:"group"`
+	Status string         `json:"status"`
+	Values []MetricChange `json:"values"`
+}
+
+// MetricChange is the old and new value of a metric for one group. Old or New is
+// nil when the group is absent from that side, in which case the delta is taken
+// against zero. PctDelta is nil when the old value is zero.
+type MetricChange struct {
+	Old      *string `json:"old"`
+	New      *string `json:"new"`
+	Delta    *string `json:"delta"`
+	PctDelta *string `json:"pctDelta"`
+}
+
+// CompareReports runs req against two inputs and diffs the results group by group.
+// Each side may add its own filters, e.g. a date range. Groups are listed in base
+// order followed by groups that only appear in the compare run; req.Limit applies
+// to the diffed rows.
+func CompareReports(ctx context.Context, basePath string, baseFilters []Filter, comparePath string, compareFilters []Filter, req ReportRequest) (CompareResponse, error) {
+	run := func(path string, filters []Filter) (ReportResponse, error) {
+		sideReq := req
+		sideReq.Limit = 0
+		sideReq.Filters = append(append([]Filter{}, req.Filters...), filters...)
+		return RunReport(ctx, path, sideReq)
+	}
+
+	base, err := run(basePath, baseFilters)
+	if err != nil {
+		return CompareResponse{}, fmt.Errorf("base report: %w", err)
+	}
+	current, err := run(comparePath, compareFilters)
+	if err != nil {
+		return CompareResponse{}, fmt.Errorf("compare report: %w", err)
+	}
+
+	resp := diffResults(base, current, len(req.GroupBy))
+	if req.Limit > 0 && len(resp.Rows) > req.Limit {
+		resp.Rows = resp.Rows[:req.Limit]
+	}
+	return resp, nil
+}
+
+func diffResults(base, current ReportResponse, groupCols int) CompareResponse {
+	resp := CompareResponse{
+		GroupBy:            base.Columns[:groupCols],
+		Metrics:            base.Columns[groupCols:],
+		Rows:               []CompareRow{},
+		BaseRowsScanned:    base.RowsScanned,
+		CompareRowsScanned: current.RowsScanned,
+	}
+
+	key := func(row []string) string { return strings.Join(row[:groupCols], "\x1f") }
+	currentRows := make(map[string][]string, len(current.Rows))
+	for _, row := range current.Rows {
+		currentRows[key(row)] = row
+	}
+
+	seen := make(map[string]bool, len(base.Rows))
+	for _, row := range base.Rows {
+		k := key(row)
+		seen[k] = true
+		resp.Rows = append(resp.Rows, diffRow(row, currentRows[k], groupCols))
+	}
+	for _, row := range current.Rows {
+		if !seen[key(row)] {
+			resp.Rows = append(resp.Rows, diffRow(nil, row, groupCols))
+		}
+	}
+	return resp
+}
+
+func diffRow(oldRow, newRow []string, groupCols int) CompareRow {
+	out := CompareRow{Status: CompareUnchanged}
+	switch {
+	case oldRow == nil:
+		out.Status = CompareAdded
+		out.Group = newRow[:groupCols]
+	case newRow == nil:
+		out.Status = CompareRemoved
+		out.Group = oldRow[:groupCols]
+	default:
+		out.Group = oldRow[:groupCols]
+	}
+
+	metricCount := len(oldRow) - groupCols
+	if oldRow == nil {
+		metricCount = len(newRow) - groupCols
+	}
+	for i := groupCols; i < groupCols+metricCount; i++ {
+		var change MetricChange
+		oldVal, newVal := "0", "0"
+		if oldRow != nil {
+			change.Old = &oldRow[i]
+			oldVal = oldRow[i]
+		}
+		if newRow != nil {
+			change.New = &newRow[i]
+			newVal = newRow[i]
+		}
+		if oldRow != nil && newRow != nil && oldVal != newVal {
+			out.Status = CompareChanged
+		}
+
+		// Metric values are exact decimals, so their deltas are computed exactly too.
+		var o, n big.Rat
+		if csvutil.InferDecimal(oldVal, &o) && csvutil.InferDecimal(newVal, &n) {
+			places := max(decimalPlaces(oldVal), decimalPlaces(newVal))
+			d := new(big.Rat).Sub(&n, &o)
+			delta := formatDecimal(d, places, RoundHalfUp)
+			change.Delta = &delta
+			if o.Sign() != 0 {
+				d.Quo(d, &o).Mul(d, big.NewRat(100, 1))
+				pct := formatDecimal(d, 2, RoundHalfUp)
+				change.PctDelta = &pct
+			}
+		}
+		out.Values = append(out.Values, change)
+	}
+	return out
+}
+
+// decimalPlaces returns the number of digits after the decimal point in a formatted number.
+func decimalPlaces(s string) int {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareReports(t *testing.T) {
+	tmpDir := t.TempDir()
+	basePath := filepath.Join(tmpDir, "jan.csv")
+	comparePath := filepath.Join(tmpDir, "feb.csv")
+	if err := os.WriteFile(basePath, []byte("country,total,date\nUSA,100,2026-01-01\nUK,50,2026-01-02\nFR,10,2026-01-03\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(comparePath, []byte("country,total,date\nUSA,150,2026-02-01\nUK,50,2026-02-02\nDE,20,2026-02-03\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := ReportRequest{
+		GroupBy: []string{"country"},
+		Metrics: []Metric{{Op: "sum", Field: "total"}, {Op: "count"}},
+	}
+
+	t.Run("two files", func(t *testing.T) {
+		resp, err := CompareReports(context.Background(), basePath, nil, comparePath, nil, req)
+		if err != nil {
+			t.Fatalf("CompareReports failed: %v", err)
+		}
+		if len(resp.Metrics) != 2 || resp.Metrics[0] != "sum(total)" {
+			t.Errorf("unexpected metrics: %v", resp.Metrics)
+		}
+		statuses := map[string]string{}
+		for _, row := range resp.Rows {
+			statuses[row.Group[0]] = row.Status
+		}
+		expected := map[string]string{"USA": CompareChanged, "UK": CompareUnchanged, "FR": CompareRemoved, "DE": CompareAdded}
+		for country, status := range expected {
+			if statuses[country] != status {
+				t.Errorf("expected %s to be %s, got %s", country, status, statuses[country])
+			}
+		}
+
+		usa := resp.Rows[0]
+		if *usa.Values[0].Old != "100.00" || *usa.Values[0].New != "150.00" {
+			t.Errorf("unexpected USA values: %s -> %s", *usa.Values[0].Old, *usa.Values[0].New)
+		}
+		if *usa.Values[0].Delta != "50.00" || *usa.Values[0].PctDelta != "50.00" {
+			t.Errorf("unexpected USA delta: %s (%s%%)", *usa.Values[0].Delta, *usa.Values[0].PctDelta)
+		}
+		if *usa.Values[1].Delta != "0" {
+			t.Errorf("expected integer count delta 0, got %s", *usa.Values[1].Delta)
+		}
+
+		added := resp.Rows[3]
+		if added.Values[0].Old != nil || *added.Values[0].Delta != "20.00" || added.Values[0].PctDelta != nil {
+			t.Errorf("unexpected added row: %+v", added.Values[0])
+		}
+	})
+
+	t.Run("date ranges within one file", func(t *testing.T) {
+		resp, err := CompareReports(context.Background(),
+			basePath, DateRange{To: "2026-01-01"}.Filters("date"),
+			basePath, DateRange{From: "2026-01-02", To: "2026-01-31"}.Filters("date"),
+			req,
+		)
+		if err != nil {
+			t.Fatalf("CompareReports failed: %v", err)
+		}
+		if resp.BaseRowsScanned != 3 || len(resp.Rows) != 3 {
+			t.Fatalf("expected 3 groups, got %+v", resp.Rows)
+		}
+		if resp.Rows[0].Status != CompareRemoved || resp.Rows[1].Status != CompareAdded {
+			t.Errorf("unexpected statuses: %s, %s", resp.Rows[0].Status, resp.Rows[1].Status)
+		}
+	})
+
+	t.Run("invalid field", func(t *testing.T) {
+		_, err := CompareReports(context.Background(), basePath, nil, comparePath, nil, ReportRequest{GroupBy: []string{"nope"}})
+		if err == nil {
+			t.Error("expected error for invalid groupBy column, got nil")
+		}
+	})
+}
+
+func TestDiffRowExactDeltas(t *testing.T) {
+	// Both totals are beyond float64 precision in cents.
+	row := diffRow([]string{"x", "90071992547409.93"}, []string{"x", "90071992547409.94"}, 1)
+	if got := *row.Values[0].Delta; got != "0.01" {
+		t.Errorf("expected exact delta 0.01, got %s", got)
+	}
+	row = diffRow([]string{"x", "3"}, []string{"x", "4"}, 1)
+	if got := *row.Values[0].PctDelta; got != "33.33" {
+		t.Errorf("expected 33.33%%, got %s", got)
+	}
+}
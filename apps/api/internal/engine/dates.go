@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayouts lists the date formats recognized in CSV values, most common first.
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04:05", "2006/01/02"}
+
+// parseDate parses a calendar date from a CSV value, ignoring any time of day.
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// daysBetween returns the number of whole days from a to b.
+func daysBetween(a, b time.Time) int {
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// Period grains accepted wherever dates are bucketed.
+const (
+	GrainDay     = "day"
+	GrainWeek    = "week"
+	GrainMonth   = "month"
+	GrainQuarter = "quarter"
+	GrainYear    = "year"
+)
+
+func validGrain(grain string) bool {
+	switch grain {
+	case GrainDay, GrainWeek, GrainMonth, GrainQuarter, GrainYear:
+		return true
+	}
+	return false
+}
+
+// truncateDate returns the first day of the period containing t. Weeks start on Monday.
+func truncateDate(t time.Time, grain string) time.Time {
+	switch grain {
+	case GrainWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.UTC)
+	case GrainMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case GrainQuarter:
+		return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case GrainYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// addPeriods moves a period start forward by n periods of the given grain.
+func addPeriods(t time.Time, grain string, n int) time.Time {
+	switch grain {
+	case GrainWeek:
+		return t.AddDate(0, 0, 7*n)
+	case GrainMonth:
+		return t.AddDate(0, n, 0)
+	case GrainQuarter:
+		return t.AddDate(0, 3*n, 0)
+	case GrainYear:
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// periodLabel formats a period start for display, e.g. "2026-03" for a month
+// or "2026-Q1" for a quarter.
+func periodLabel(t time.Time, grain string) string {
+	switch grain {
+	case GrainMonth:
+		return t.Format("2006-01")
+	case GrainQuarter:
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	case GrainYear:
+		return t.Format("2006")
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"math/big"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// Rounding modes for Metric.Rounding.
+const (
+	RoundHalfUp   = "half_up"
+	RoundHalfEven = "half_even"
+)
+
+// DefaultScale is the number of decimal places of sum and avg metrics unless a
+// metric sets its own.
+const DefaultScale = 2
+
+var bigTen = big.NewInt(10)
+
+func validRounding(mode string) bool {
+	switch mode {
+	case "", RoundHalfUp, RoundHalfEven, "bankers":
+		return true
+	}
+	return false
+}
+
+// formatDecimal rounds x to scale decimal places and formats it. Half-up rounds
+// ties away from zero; half-even ("bankers") rounds ties to the even digit.
+func formatDecimal(x *big.Rat, scale int, mode string) string {
+	shifted := new(big.Int).Mul(x.Num(), new(big.Int).Exp(bigTen, big.NewInt(int64(scale)), nil))
+	q, r := new(big.Int).QuoRem(shifted, x.Denom(), new(big.Int))
+
+	// Compare twice the remainder with the denominator to decide the rounding.
+	r.Abs(r).Lsh(r, 1)
+	switch c := r.Cmp(x.Denom()); {
+	case c > 0, c == 0 && (mode != RoundHalfEven && mode != "bankers" || q.Bit(0) == 1):
+		if x.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	digits := new(big.Int).Abs(q).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if q.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// parseAmount parses an amount exactly. Values that are not numbers count as zero.
+func parseAmount(s string) *big.Rat {
+	x := new(big.Rat)
+	if !csvutil.InferDecimal(s, x) {
+		x.SetInt64(0)
+	}
+	return x
+}
+
+// formatAmount formats an amount with two decimal places, rounding half up.
+func formatAmount(x *big.Rat) string {
+	return formatDecimal(x, DefaultScale, RoundHalfUp)
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		value    string
+		scale    int
+		rounding string
+		want     string
+	}{
+		{"2.345", 2, "", "2.35"},
+		{"2.345", 2, RoundHalfEven, "2.34"},
+		{"2.355", 2, "bankers", "2.36"},
+		{"-2.345", 2, RoundHalfUp, "-2.35"},
+		{"-2.345", 2, RoundHalfEven, "-2.34"},
+		{"-0.001", 2, "", "0.00"},
+		{"0.5", 0, RoundHalfEven, "0"},
+		{"1.5", 0, RoundHalfEven, "2"},
+		{"0.05", 3, "", "0.050"},
+		{"1/3", 4, "", "0.3333"},
+	}
+	for _, tt := range tests {
+		x, _ := new(big.Rat).SetString(tt.value)
+		if got := formatDecimal(x, tt.scale, tt.rounding); got != tt.want {
+			t.Errorf("formatDecimal(%s, %d, %q) = %s, want %s", tt.value, tt.scale, tt.rounding, got, tt.want)
+		}
+	}
+}
+
+func TestRunReportExactDecimals(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("category,amount\n")
+	for i := 0; i < 1000; i++ {
+		sb.WriteString("fees,0.10\n")
+	}
+	sb.WriteString("tax,0.125\n")
+
+	csvPath := filepath.Join(t.TempDir(), "amounts.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+
+	t.Run("sums do not drift", func(t *testing.T) {
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+			GroupBy: []string{"category"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
+			Filters: []Filter{{Field: "category", Op: "eq", Value: "fees"}},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		if got := resp.Rows[0][1]; got != "100.00" {
+			t.Errorf("expected 100.00, got %s", got)
+		}
+	})
+
+	t.Run("per-metric scale and rounding", func(t *testing.T) {
+		three := 3
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+			Metrics: []Metric{
+				{Op: "avg", Field: "amount"},
+				{Op: "avg", Field: "amount", Rounding: RoundHalfEven},
+				{Op: "sum", Field: "amount", Scale: &three},
+			},
+			Filters: []Filter{{Field: "category", Op: "eq", Value: "tax"}},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		want := []string{"0.13", "0.12", "0.125"}
+		for i, w := range want {
+			if resp.Rows[0][i] != w {
+				t.Errorf("metric %d: expected %s, got %s", i, w, resp.Rows[0][i])
+			}
+		}
+	})
+
+	t.Run("invalid rounding mode", func(t *testing.T) {
+		_, err := RunReport(context.Background(), csvPath, ReportRequest{
+			Metrics: []Metric{{Op: "sum", Field: "amount", Rounding: "up"}},
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid rounding mode") {
+			t.Errorf("expected invalid rounding mode error, got %v", err)
+		}
+	})
+}
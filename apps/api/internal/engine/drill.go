@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+)
+
+// DefaultDrillLimit and MaxDrillLimit bound the page size of DrillThrough when
+// the rows are collected into the response.
+const (
+	DefaultDrillLimit = 100
+	MaxDrillLimit     = 1000
+)
+
+// DrillRequest selects the raw rows behind one group of a report: the rows that
+// pass the report's Filters and whose GroupBy values, after joins and time
+// bucketing, equal Group. Columns projects the returned rows and defaults to all
+// columns.
+type DrillRequest struct {
+	GroupBy    []string    `json:"groupBy"`
+	Group      []string    `json:"group"`
+	Filters    []Filter    `json:"filters"`
+	Joins      []Join      `json:"joins,omitempty"`
+	TimeBucket *TimeBucket `json:"timeBucket,omitempty"`
+	Columns    []string    `json:"columns,omitempty"`
+	Offset     int         `json:"offset"`
+	Limit      int         `json:"limit"`
+}
+
+// DrillResponse is a page of matching rows. Matched counts every matching row,
+// so HasMore tells whether a further page exists.
+type DrillResponse struct {
+	Columns     []string   `json:"columns"`
+	Rows        [][]string `json:"rows"`
+	Offset      int        `json:"offset"`
+	Limit       int        `json:"limit"`
+	Matched     int        `json:"matched"`
+	HasMore     bool       `json:"hasMore"`
+	RowsScanned int        `json:"rowsScanned"`
+}
+
+// DrillThrough streams the rows of one report group. emit is called with the
+// column names once the request has been validated and then with each row of the
+// requested page, where a zero Limit means every matching row. When emit is nil
+// the rows are collected into the response instead and the page size defaults to
+// DefaultDrillLimit, capped at MaxDrillLimit.
+func DrillThrough(ctx context.Context, filePath string, req DrillRequest, emit func(row []string) error) (DrillResponse, error) {
+	if req.Offset < 0 || req.Limit < 0 {
+		return DrillResponse{}, fmt.Errorf("invalid page: offset and limit must not be negative")
+	}
+	if len(req.Group) != len(req.GroupBy) {
+		return DrillResponse{}, fmt.Errorf("invalid group: expected %d values, got %d", len(req.GroupBy), len(req.Group))
+	}
+	limit := req.Limit
+	if emit == nil {
+		if limit == 0 {
+			limit = DefaultDrillLimit
+		}
+		limit = min(limit, MaxDrillLimit)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return DrillResponse{}, fmt.Errorf("failed to open report file: %w", err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+
+	headers, err := csvReader.Read()
+	if err != nil {
+		return DrillResponse{}, fmt.Errorf("failed to read csv headers: %w", err)
+	}
+	headers, joins, err := planJoins(ctx, headers, req.Joins)
+	if err != nil {
+		return DrillResponse{}, err
+	}
+	headerMap := indexHeaders(headers)
+
+	groupByIndices, err := groupByColumns(headerMap, req.GroupBy)
+	if err != nil {
+		return DrillResponse{}, err
+	}
+	bucket, err := compileTimeBucket(req.TimeBucket, req.GroupBy, headerMap)
+	if err != nil {
+		return DrillResponse{}, err
+	}
+	filters, err := compileFilters(headerMap, req.Filters)
+	if err != nil {
+		return DrillResponse{}, err
+	}
+
+	columns := req.Columns
+	if len(columns) == 0 {
+		columns = headers
+	}
+	projection := make([]int, len(columns))
+	for i, col := range columns {
+		idx, ok := headerMap[col]
+		if !ok {
+			return DrillResponse{}, fmt.Errorf("invalid column: %s", col)
+		}
+		projection[i] = idx
+	}
+
+	resp := DrillResponse{Columns: columns, Rows: [][]string{}, Offset: req.Offset, Limit: limit}
+	if emit == nil {
+		emit = func(row []string) error {
+			resp.Rows = append(resp.Rows, row)
+			return nil
+		}
+	} else if err := emit(columns); err != nil {
+		return resp, err
+	}
+
+	emitted := 0
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Like RunReport, stop at a malformed record and keep the rows
+			// read up to there.
+			log.Printf("error reading csv row: %v", err)
+			break
+		}
+		resp.RowsScanned++
+		if err := checkContext(ctx, resp.RowsScanned); err != nil {
+			return resp, err
+		}
+
+		for _, row := range applyJoins(joins, row) {
+			if !matchFilters(filters, row) {
+				continue
+			}
+			group, ok := rowGroup(row, groupByIndices, bucket, nil)
+			if !ok || !slices.Equal(group, req.Group) {
+				continue
+			}
+			resp.Matched++
+			if resp.Matched <= req.Offset || (limit > 0 && emitted >= limit) {
+				continue
+			}
+
+			if err := emit(project(row, projection)); err != nil {
+				return resp, err
+			}
+			emitted++
+		}
+	}
+	resp.HasMore = limit > 0 && resp.Matched > req.Offset+emitted
+	return resp, nil
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDrillThrough(t *testing.T) {
+	csvContent := `invoice_id,region,invoice_date,amount
+1,EU,2026-01-05,100
+2,US,2026-01-06,50
+3,EU,2026-01-20,70
+4,EU,2026-02-01,30
+5,EU,2026-01-28,10
+`
+	csvPath := filepath.Join(t.TempDir(), "invoices.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+
+	req := DrillRequest{
+		GroupBy:    []string{"region", "invoice_date"},
+		Group:      []string{"EU", "2026-01"},
+		Filters:    []Filter{{Field: "amount", Op: "gte", Value: "20"}},
+		TimeBucket: &TimeBucket{Field: "invoice_date", Grain: GrainMonth},
+		Columns:    []string{"invoice_id", "amount"},
+		Limit:      1,
+	}
+	resp, err := DrillThrough(context.Background(), csvPath, req, nil)
+	if err != nil {
+		t.Fatalf("DrillThrough failed: %v", err)
+	}
+	if resp.Matched != 2 || !resp.HasMore || len(resp.Rows) != 1 || strings.Join(resp.Rows[0], ",") != "1,100" {
+		t.Errorf("unexpected first page: %+v", resp)
+	}
+
+	req.Offset = 1
+	resp, err = DrillThrough(context.Background(), csvPath, req, nil)
+	if err != nil {
+		t.Fatalf("DrillThrough failed: %v", err)
+	}
+	if resp.HasMore || len(resp.Rows) != 1 || strings.Join(resp.Rows[0], ",") != "3,70" {
+		t.Errorf("unexpected second page: %+v", resp)
+	}
+
+	t.Run("emit streams header and every row", func(t *testing.T) {
+		var lines []string
+		_, err := DrillThrough(context.Background(), csvPath, DrillRequest{
+			GroupBy: []string{"region"},
+			Group:   []string{"EU"},
+			Columns: []string{"invoice_id"},
+		}, func(row []string) error {
+			lines = append(lines, strings.Join(row, ","))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("DrillThrough failed: %v", err)
+		}
+		if got := strings.Join(lines, "|"); got != "invoice_id|1|3|4|5" {
+			t.Errorf("unexpected rows: %s", got)
+		}
+	})
+
+	t.Run("stops at a malformed record like a report", func(t *testing.T) {
+		broken := filepath.Join(t.TempDir(), "broken.csv")
+		if err := os.WriteFile(broken, []byte(csvContent+"6,EU,\"2026-01-30,5\n7,EU,2026-01-31,5\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		drill := DrillRequest{GroupBy: []string{"region"}, Group: []string{"EU"}, Columns: []string{"invoice_id"}}
+		resp, err := DrillThrough(context.Background(), broken, drill, nil)
+		if err != nil {
+			t.Fatalf("DrillThrough failed: %v", err)
+		}
+		report, err := RunReport(context.Background(), broken, ReportRequest{GroupBy: []string{"region"}, Metrics: []Metric{{Op: "count"}}})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		if resp.Matched != 4 || resp.RowsScanned != report.RowsScanned {
+			t.Errorf("expected the 4 EU rows before the malformed record, got %+v and %d rows in the report", resp, report.RowsScanned)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, req := range []DrillRequest{
+			{GroupBy: []string{"region"}},
+			{GroupBy: []string{"region"}, Group: []string{"EU"}, Columns: []string{"missing"}},
+			{GroupBy: []string{"region"}, Group: []string{"EU"}, Offset: -1},
+		} {
+			if _, err := DrillThrough(context.Background(), csvPath, req, nil); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("%+v: expected invalid error, got %v", req, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// ErrTimeout and ErrCancelled are returned when a query runs out of its time
+// budget or its caller goes away. They wrap context.DeadlineExceeded and
+// context.Canceled, which csvutil read loops return as is, so callers can test
+// for either with errors.Is.
+var (
+	ErrTimeout   = fmt.Errorf("query timed out: %w", context.DeadlineExceeded)
+	ErrCancelled = fmt.Errorf("query cancelled: %w", context.Canceled)
+)
+
+// ErrTooManyGroups is returned when the groups of a report exceed
+// GroupMemoryBudget. The error wrapping it says how many groups were found.
+var ErrTooManyGroups = errors.New("too many groups")
+
+// checkContext reports ErrTimeout or ErrCancelled once ctx is done, checking
+// only on every csvutil.CheckInterval-th row to keep read loops cheap.
+func checkContext(ctx context.Context, rows int) error {
+	if rows%csvutil.CheckInterval != 0 {
+		return nil
+	}
+	return contextError(ctx)
+}
+
+func contextError(ctx context.Context) error {
+	switch err := ctx.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	default:
+		return ErrCancelled
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+type filterInfo struct {
+	idx   int
+	op    string
+	value string
+	num   float64
+	isNum bool
+}
+
+func compileFilters(headerMap map[string]int, filters []Filter) ([]filterInfo, error) {
+	var compiled []filterInfo
+	for _, f := range filters {
+		idx, ok := headerMap[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("invalid filter field: %s", f.Field)
+		}
+		switch f.Op {
+		case "eq", "neq", "contains", "gt", "gte", "lt", "lte":
+		default:
+			return nil, fmt.Errorf("invalid filter op: %s", f.Op)
+		}
+		num, isNum := csvutil.InferNumeric(f.Value)
+		compiled = append(compiled, filterInfo{idx: idx, op: f.Op, value: f.Value, num: num, isNum: isNum})
+	}
+	return compiled, nil
+}
+
+// matchFilters reports whether row satisfies every filter.
+func matchFilters(filters []filterInfo, row []string) bool {
+	for _, f := range filters {
+		if f.idx >= len(row) {
+			return false
+		}
+		val := row[f.idx]
+		switch f.op {
+		case "eq":
+			if val != f.value {
+				return false
+			}
+		case "neq":
+			if val == f.value {
+				return false
+			}
+		case "contains":
+			if !strings.Contains(strings.ToLower(val), strings.ToLower(f.value)) {
+				return false
+			}
+		default:
+			cmp := f.compare(val)
+			switch f.op {
+			case "gt":
+				if cmp <= 0 {
+					return false
+				}
+			case "gte":
+				if cmp < 0 {
+					return false
+				}
+			case "lt":
+				if cmp >= 0 {
+					return false
+				}
+			case "lte":
+				if cmp > 0 {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// compare orders val against the filter value, numerically when both are numbers.
+func (f filterInfo) compare(val string) int {
+	if f.isNum {
+		if n, ok := csvutil.InferNumeric(val); ok {
+			switch {
+			case n < f.num:
+				return -1
+			case n > f.num:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(val, f.value)
+}
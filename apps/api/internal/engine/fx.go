@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// FX rate policies for CurrencyConversion.
+const (
+	RatePolicySpot     = "spot"
+	RatePolicyMonthEnd = "month_end"
+)
+
+// CurrencyConversion converts the fields of sum, avg, median and percentile
+// metrics into a single reporting currency using an uploaded FX rate table with
+// date, from, to and rate columns, so window metrics over them are in that
+// currency too. A rate converts one unit of "from" into "to"; inverse pairs are
+// used when only the opposite direction is present.
+type CurrencyConversion struct {
+	FXReportID string `json:"fxReportId"`
+	// FXPath is the CSV backing FXReportID. It is resolved by the caller.
+	FXPath string `json:"-"`
+	// Target is the reporting currency, e.g. "EUR".
+	Target string `json:"target"`
+	// CurrencyField and DateField identify each row's currency and transaction
+	// date. They default to "currency" and to no date (latest rate).
+	CurrencyField string `json:"currencyField"`
+	DateField     string `json:"dateField"`
+	// Policy is "spot" (default), the latest rate on or before the transaction
+	// date, or "month_end", the latest rate on or before the end of its month.
+	Policy string `json:"policy"`
+}
+
+// MissingRate reports rows whose amounts could not be converted and were left
+// out of sum, avg, median and percentile metrics. Date is the rate date that was
+// looked up. Rows counts records of the report file, so a record joined to
+// several rows counts once.
+type MissingRate struct {
+	Currency string `json:"currency"`
+	Date     string `json:"date"`
+	Rows     int    `json:"rows"`
+}
+
+type fxPoint struct {
+	date time.Time
+	rate *big.Rat
+}
+
+// fxConverter converts row amounts into the target currency and records rows
+// for which no rate was found.
+type fxConverter struct {
+	target      string
+	policy      string
+	currencyIdx int
+	dateIdx     int
+	rates       map[string][]fxPoint
+	missing     map[[2]string]int
+	missingKeys [][2]string
+}
+
+func newFXConverter(ctx context.Context, conv *CurrencyConversion, headerMap map[string]int) (*fxConverter, error) {
+	if conv.Target == "" {
+		return nil, fmt.Errorf("invalid currency conversion: target currency is required")
+	}
+	policy := defaultString(conv.Policy, RatePolicySpot)
+	if policy != RatePolicySpot && policy != RatePolicyMonthEnd {
+		return nil, fmt.Errorf("invalid rate policy: %s", conv.Policy)
+	}
+
+	c := &fxConverter{
+		target:  strings.ToUpper(conv.Target),
+		policy:  policy,
+		dateIdx: -1,
+		rates:   make(map[string][]fxPoint),
+		missing: make(map[[2]string]int),
+	}
+	var ok bool
+	currencyField := defaultString(conv.CurrencyField, "currency")
+	if c.currencyIdx, ok = headerMap[currencyField]; !ok {
+		return nil, fmt.Errorf("invalid currency field: %s", currencyField)
+	}
+	if conv.DateField != "" {
+		if c.dateIdx, ok = headerMap[conv.DateField]; !ok {
+			return nil, fmt.Errorf("invalid currency date field: %s", conv.DateField)
+		}
+	}
+
+	_, err := forEachRow(ctx, conv.FXPath, []string{"date", "from", "to", "rate"}, nil, func(v []string) error {
+		date, ok := parseDate(v[0])
+		rate := new(big.Rat)
+		if !ok || !csvutil.InferDecimal(v[3], rate) || rate.Sign() <= 0 {
+			return nil
+		}
+		from, to := strings.ToUpper(v[1]), strings.ToUpper(v[2])
+		c.rates[from+"/"+to] = append(c.rates[from+"/"+to], fxPoint{date: date, rate: rate})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fx table: %w", err)
+	}
+	for _, points := range c.rates {
+		slices.SortStableFunc(points, func(a, b fxPoint) int { return a.date.Compare(b.date) })
+	}
+	return c, nil
+}
+
+// rowRate returns the exact factor converting the row's amounts into the target
+// currency, or nil when the row is already in the target currency. It reports
+// false, with the currency and rate date that were looked up, when no rate
+// applies.
+func (c *fxConverter) rowRate(row []string) (*big.Rat, [2]string, bool) {
+	currency := ""
+	if c.currencyIdx < len(row) {
+		currency = strings.ToUpper(strings.TrimSpace(row[c.currencyIdx]))
+	}
+	if currency == c.target {
+		return nil, [2]string{}, true
+	}
+
+	asOf := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	dateLabel := "latest"
+	if c.dateIdx >= 0 {
+		date, ok := time.Time{}, false
+		if c.dateIdx < len(row) {
+			date, ok = parseDate(row[c.dateIdx])
+		}
+		if !ok {
+			return nil, [2]string{currency, ""}, false
+		}
+		asOf = date
+		if c.policy == RatePolicyMonthEnd {
+			asOf = addPeriods(truncateDate(date, GrainMonth), GrainMonth, 1).AddDate(0, 0, -1)
+		}
+		dateLabel = asOf.Format("2006-01-02")
+	}
+
+	if currency != "" {
+		if rate, ok := latestRate(c.rates[currency+"/"+c.target], asOf); ok {
+			return rate, [2]string{}, true
+		}
+		if rate, ok := latestRate(c.rates[c.target+"/"+currency], asOf); ok {
+			return new(big.Rat).Inv(rate), [2]string{}, true
+		}
+	}
+	return nil, [2]string{currency, dateLabel}, false
+}
+
+// recordMissing counts a record that lacked the rate for a currency and date.
+func (c *fxConverter) recordMissing(key [2]string) {
+	if _, ok := c.missing[key]; !ok {
+		c.missingKeys = append(c.missingKeys, key)
+	}
+	c.missing[key]++
+}
+
+// fork returns a converter sharing c's rates with its own record of missing
+// rates, for one chunk of a parallel scan. It returns nil when c is nil.
+func (c *fxConverter) fork() *fxConverter {
+	if c == nil {
+		return nil
+	}
+	part := *c
+	part.missing = make(map[[2]string]int)
+	part.missingKeys = nil
+	return &part
+}
+
+// merge adds the missing rates recorded by a chunk's converter to c's.
+func (c *fxConverter) merge(part *fxConverter) {
+	if c == nil {
+		return
+	}
+	for _, key := range part.missingKeys {
+		if _, ok := c.missing[key]; !ok {
+			c.missingKeys = append(c.missingKeys, key)
+		}
+		c.missing[key] += part.missing[key]
+	}
+}
+
+// missingRates lists the currency and date combinations that lacked a rate, in
+// the order they were first encountered.
+func (c *fxConverter) missingRates() []MissingRate {
+	var out []MissingRate
+	for _, key := range c.missingKeys {
+		out = append(out, MissingRate{Currency: key[0], Date: key[1], Rows: c.missing[key]})
+	}
+	return out
+}
+
+// latestRate returns the rate of the last point on or before asOf.
+func latestRate(points []fxPoint, asOf time.Time) (*big.Rat, bool) {
+	i, _ := slices.BinarySearchFunc(points, asOf, func(p fxPoint, t time.Time) int {
+		if p.date.After(t) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return nil, false
+	}
+	return points[i-1].rate, true
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunReportCurrencyConversion(t *testing.T) {
+	tmpDir := t.TempDir()
+	fxPath := filepath.Join(tmpDir, "fx.csv")
+	invoicesPath := filepath.Join(tmpDir, "invoices.csv")
+	fx := `date,from,to,rate
+2026-01-01,EUR,USD,1.10
+2026-01-31,EUR,USD,1.20
+2026-02-01,EUR,USD,1.30
+2026-01-01,USD,GBP,0.80
+`
+	invoices := `invoice_id,invoice_date,currency,total,country
+1,2026-01-15,USD,100.00,US
+2,2026-01-15,EUR,100.00,DE
+3,2026-02-10,EUR,100.00,DE
+4,2026-01-20,GBP,80.00,UK
+5,2026-01-20,JPY,1000,JP
+6,2025-12-01,EUR,100.00,DE
+`
+	if err := os.WriteFile(fxPath, []byte(fx), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invoicesPath, []byte(invoices), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(policy string) ReportResponse {
+		t.Helper()
+		resp, err := RunReport(context.Background(), invoicesPath, ReportRequest{
+			GroupBy: []string{"country"},
+			Metrics: []Metric{{Op: "sum", Field: "total"}, {Op: "avg", Field: "total"}},
+			Currency: &CurrencyConversion{
+				FXPath: fxPath, Target: "usd", DateField: "invoice_date", Policy: policy,
+			},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("spot", func(t *testing.T) {
+		resp := run(RatePolicySpot)
+		// DE: 100 * 1.10 (Jan 15) + 100 * 1.30 (Feb 10); the December row has no rate yet.
+		// UK: 80 / 0.80 via the inverse USD/GBP pair.
+		expected := map[string]string{"US": "100.00", "DE": "240.00", "UK": "100.00", "JP": "0.00"}
+		for _, row := range resp.Rows {
+			if expected[row[0]] != row[1] {
+				t.Errorf("expected %s for %s, got %s", expected[row[0]], row[0], row[1])
+			}
+		}
+		if resp.Currency != "USD" {
+			t.Errorf("expected currency USD, got %s", resp.Currency)
+		}
+		if len(resp.MissingRates) != 2 {
+			t.Fatalf("expected 2 missing rates, got %+v", resp.MissingRates)
+		}
+		if m := resp.MissingRates[0]; m.Currency != "JPY" || m.Date != "2026-01-20" || m.Rows != 1 {
+			t.Errorf("unexpected missing rate: %+v", m)
+		}
+	})
+
+	t.Run("month end", func(t *testing.T) {
+		resp := run(RatePolicyMonthEnd)
+		// Jan 15 uses the Jan 31 rate, Feb 10 the Feb 1 rate, Dec 1 still has none.
+		for _, row := range resp.Rows {
+			if row[0] == "DE" && (row[1] != "250.00" || row[2] != "125.00") {
+				t.Errorf("expected DE sum 250.00 avg 125.00, got %v", row[1:])
+			}
+		}
+	})
+
+	t.Run("missing rates counted per record", func(t *testing.T) {
+		linesPath := filepath.Join(tmpDir, "lines.csv")
+		if err := os.WriteFile(linesPath, []byte("invoice_id,sku\n5,A\n5,B\n2,A\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := RunReport(context.Background(), invoicesPath, ReportRequest{
+			Metrics: []Metric{{Op: "sum", Field: "total"}},
+			Joins: []Join{{
+				ReportID: "lines", FilePath: linesPath, Type: JoinInner, Prefix: "line.",
+				On: []JoinKey{{Left: "invoice_id", Right: "invoice_id"}},
+			}},
+			Currency: &CurrencyConversion{FXPath: fxPath, Target: "USD", DateField: "invoice_date"},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		if len(resp.MissingRates) != 1 || resp.MissingRates[0].Currency != "JPY" || resp.MissingRates[0].Rows != 1 {
+			t.Errorf("expected the JPY invoice missing a rate once, got %+v", resp.MissingRates)
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		for _, conv := range []CurrencyConversion{
+			{FXPath: fxPath},
+			{FXPath: fxPath, Target: "USD", Policy: "average"},
+			{FXPath: fxPath, Target: "USD", CurrencyField: "ccy"},
+		} {
+			_, err := RunReport(context.Background(), invoicesPath, ReportRequest{
+				Metrics:  []Metric{{Op: "sum", Field: "total"}},
+				Currency: &conv,
+			})
+			if err == nil {
+				t.Errorf("expected error for %+v, got nil", conv)
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Join types supported by ReportRequest.Joins.
+const (
+	JoinInner = "inner"
+	JoinLeft  = "left"
+	JoinAnti  = "anti"
+)
+
+// Join combines the rows of the report with those of a second dataset.
+// Inner joins emit one row per matching pair, left joins keep unmatched rows with
+// empty joined columns, and anti joins keep only rows without a match. Joined
+// columns are named Prefix + column; the prefix defaults to ReportID + ".".
+// Anti joins add no columns. Rows with an empty key value never match.
+type Join struct {
+	ReportID string    `json:"reportId"`
+	Type     string    `json:"type"`
+	On       []JoinKey `json:"on"`
+	Prefix   string    `json:"prefix,omitempty"`
+	// FilePath is the CSV backing ReportID. It is resolved by the caller.
+	FilePath string `json:"-"`
+}
+
+// JoinKey pairs a column of the rows being joined with a column of the joined dataset.
+type JoinKey struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+type joinPlan struct {
+	typ       string
+	leftIdx   []int
+	leftWidth int
+	width     int
+	index     map[string][][]string
+}
+
+// planJoins loads every joined dataset into a hash index and returns the combined
+// header. Each join may use columns added by the joins before it.
+func planJoins(ctx context.Context, headers []string, joins []Join) ([]string, []joinPlan, error) {
+	combined := append([]string{}, headers...)
+	var plans []joinPlan
+	for _, j := range joins {
+		switch j.Type {
+		case JoinInner, JoinLeft, JoinAnti:
+		default:
+			return nil, nil, fmt.Errorf("invalid join type: %s", j.Type)
+		}
+		if len(j.On) == 0 {
+			return nil, nil, fmt.Errorf("invalid join on %s: at least one key is required", j.ReportID)
+		}
+
+		headerMap := indexHeaders(combined)
+		plan := joinPlan{typ: j.Type, leftWidth: len(combined)}
+		rightKeys := make([]string, len(j.On))
+		for i, k := range j.On {
+			idx, ok := headerMap[k.Left]
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid join column: %s", k.Left)
+			}
+			plan.leftIdx = append(plan.leftIdx, idx)
+			rightKeys[i] = k.Right
+		}
+
+		rightHeaders, index, err := loadJoinIndex(ctx, j.FilePath, rightKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		plan.index = index
+		if j.Type != JoinAnti {
+			plan.width = len(rightHeaders)
+			prefix := j.Prefix
+			if prefix == "" {
+				prefix = j.ReportID + "."
+			}
+			for _, h := range rightHeaders {
+				combined = append(combined, prefix+h)
+			}
+		}
+		plans = append(plans, plan)
+	}
+	return combined, plans, nil
+}
+
+func loadJoinIndex(ctx context.Context, filePath string, keyColumns []string) ([]string, map[string][][]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open join file: %w", err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	headers, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read join csv headers: %w", err)
+	}
+
+	headerMap := indexHeaders(headers)
+	keyIdx := make([]int, len(keyColumns))
+	for i, k := range keyColumns {
+		idx, ok := headerMap[k]
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid join column: %s", k)
+		}
+		keyIdx[i] = idx
+	}
+
+	index := make(map[string][][]string)
+	for rows := 1; ; rows++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read join csv: %w", err)
+		}
+		if err := checkContext(ctx, rows); err != nil {
+			return nil, nil, err
+		}
+		key, ok := joinKey(row, keyIdx)
+		if !ok {
+			continue
+		}
+		padded := make([]string, len(headers))
+		copy(padded, row)
+		index[key] = append(index[key], padded)
+	}
+	return headers, index, nil
+}
+
+func joinKey(row []string, idx []int) (string, bool) {
+	parts := make([]string, len(idx))
+	for i, c := range idx {
+		if c >= len(row) || row[c] == "" {
+			return "", false
+		}
+		parts[i] = row[c]
+	}
+	return strings.Join(parts, "\x1f"), true
+}
+
+// applyJoins expands one source row into the joined rows it produces.
+func applyJoins(plans []joinPlan, row []string) [][]string {
+	rows := [][]string{row}
+	for _, p := range plans {
+		var next [][]string
+		for _, r := range rows {
+			var matches [][]string
+			if key, ok := joinKey(r, p.leftIdx); ok {
+				matches = p.index[key]
+			}
+			switch {
+			case p.typ == JoinAnti:
+				if len(matches) == 0 {
+					next = append(next, r)
+				}
+			case len(matches) > 0:
+				for _, m := range matches {
+					next = append(next, append(p.widen(r), m...))
+				}
+			case p.typ == JoinLeft:
+				next = append(next, append(p.widen(r), make([]string, p.width)...))
+			}
+		}
+		rows = next
+	}
+	return rows
+}
+
+// widen copies r, padded or truncated to the width of the rows being joined,
+// with spare capacity for the joined columns.
+func (p joinPlan) widen(r []string) []string {
+	out := make([]string, p.leftWidth, p.leftWidth+p.width)
+	copy(out, r)
+	return out
+}
+
+func indexHeaders(headers []string) map[string]int {
+	headerMap := make(map[string]int, len(headers))
+	for i, h := range headers {
+		headerMap[h] = i
+	}
+	return headerMap
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunReportJoins(t *testing.T) {
+	tmpDir := t.TempDir()
+	invoicesPath := filepath.Join(tmpDir, "invoices.csv")
+	paymentsPath := filepath.Join(tmpDir, "payments.csv")
+	if err := os.WriteFile(invoicesPath, []byte("invoice_id,customer,country\nINV-1,Acme,USA\nINV-2,Globex,UK\nINV-3,Acme,USA\nINV-4,Initech,USA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paymentsPath, []byte("payment_id,invoice_id,amount\nP1,INV-1,10\nP2,INV-1,5\nP3,INV-2,20\nP4,INV-9,7\nP5,,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("inner join groups payments by invoice customer", func(t *testing.T) {
+		req := ReportRequest{
+			GroupBy: []string{"inv.customer"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}, {Op: "count"}},
+			Joins: []Join{{
+				ReportID: "invoices", FilePath: invoicesPath, Type: JoinInner, Prefix: "inv.",
+				On: []JoinKey{{Left: "invoice_id", Right: "invoice_id"}},
+			}},
+		}
+		resp, err := RunReport(context.Background(), paymentsPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		expected := map[string]string{"Acme": "15.00", "Globex": "20.00"}
+		if len(resp.Rows) != 2 {
+			t.Fatalf("expected 2 rows, got %v", resp.Rows)
+		}
+		for _, row := range resp.Rows {
+			if expected[row[0]] != row[1] {
+				t.Errorf("expected %s for %s, got %s", expected[row[0]], row[0], row[1])
+			}
+		}
+		if resp.RowsScanned != 5 {
+			t.Errorf("expected 5 rows scanned, got %d", resp.RowsScanned)
+		}
+	})
+
+	t.Run("left join keeps unmatched rows and fans out matches", func(t *testing.T) {
+		req := ReportRequest{
+			GroupBy: []string{"invoice_id"},
+			Metrics: []Metric{{Op: "count"}, {Op: "sum", Field: "payments.amount"}},
+			Joins: []Join{{
+				ReportID: "payments", FilePath: paymentsPath, Type: JoinLeft,
+				On: []JoinKey{{Left: "invoice_id", Right: "invoice_id"}},
+			}},
+		}
+		resp, err := RunReport(context.Background(), invoicesPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		expected := map[string][2]string{
+			"INV-1": {"2", "15.00"},
+			"INV-2": {"1", "20.00"},
+			"INV-3": {"1", "0.00"},
+			"INV-4": {"1", "0.00"},
+		}
+		for _, row := range resp.Rows {
+			want := expected[row[0]]
+			if row[1] != want[0] || row[2] != want[1] {
+				t.Errorf("expected %v for %s, got %v", want, row[0], row[1:])
+			}
+		}
+	})
+
+	t.Run("anti join finds invoices without payment", func(t *testing.T) {
+		req := ReportRequest{
+			GroupBy: []string{"invoice_id"},
+			Metrics: []Metric{{Op: "count"}},
+			Joins: []Join{{
+				ReportID: "payments", FilePath: paymentsPath, Type: JoinAnti,
+				On: []JoinKey{{Left: "invoice_id", Right: "invoice_id"}},
+			}},
+		}
+		resp, err := RunReport(context.Background(), invoicesPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		if len(resp.Rows) != 2 || resp.Rows[0][0] != "INV-3" || resp.Rows[1][0] != "INV-4" {
+			t.Errorf("expected INV-3 and INV-4, got %v", resp.Rows)
+		}
+	})
+
+	t.Run("multi-key join", func(t *testing.T) {
+		req := ReportRequest{
+			Metrics: []Metric{{Op: "count"}},
+			Joins: []Join{{
+				ReportID: "self", FilePath: invoicesPath, Type: JoinInner,
+				On: []JoinKey{{Left: "customer", Right: "customer"}, {Left: "country", Right: "country"}},
+			}},
+		}
+		resp, err := RunReport(context.Background(), invoicesPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		// Acme/USA matches itself twice for each of its two invoices.
+		if resp.Rows[0][0] != "6" {
+			t.Errorf("expected 6 joined rows, got %s", resp.Rows[0][0])
+		}
+	})
+
+	t.Run("invalid join", func(t *testing.T) {
+		cases := []Join{
+			{ReportID: "p", FilePath: paymentsPath, Type: "outer", On: []JoinKey{{Left: "invoice_id", Right: "invoice_id"}}},
+			{ReportID: "p", FilePath: paymentsPath, Type: JoinInner, On: []JoinKey{{Left: "nope", Right: "invoice_id"}}},
+			{ReportID: "p", FilePath: paymentsPath, Type: JoinInner, On: []JoinKey{{Left: "invoice_id", Right: "nope"}}},
+			{ReportID: "p", FilePath: paymentsPath, Type: JoinInner},
+		}
+		for _, j := range cases {
+			if _, err := RunReport(context.Background(), invoicesPath, ReportRequest{Joins: []Join{j}}); err == nil {
+				t.Errorf("expected error for join %+v, got nil", j)
+			}
+		}
+	})
+}
@@ -0,0 +1,327 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// KPIRequest configures the receivables KPI pack computed over [From, To].
+// Column names default to those of the bundled invoice and payment samples.
+type KPIRequest struct {
+	InvoicesReportID string `json:"invoicesReportId"`
+	PaymentsReportID string `json:"paymentsReportId"`
+	// InvoicesPath and PaymentsPath are the CSV files backing the report IDs.
+	// They are resolved by the caller.
+	InvoicesPath string `json:"-"`
+	PaymentsPath string `json:"-"`
+
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	InvoiceColumns InvoiceColumns `json:"invoiceColumns"`
+	PaymentColumns PaymentColumns `json:"paymentColumns"`
+	// ExcludeStatuses lists invoice statuses that are not receivable.
+	// Defaults to DefaultExcludedStatuses.
+	ExcludeStatuses []string `json:"excludeStatuses"`
+}
+
+// MaxKPIMonths is the longest range, in calendar months, that RunKPIs accepts.
+// Every month of the trend rescans all invoices.
+var MaxKPIMonths = 120
+
+// KPIResponse holds the KPIs for the whole period, a monthly trend and the
+// average days to pay per customer. DuplicateInvoices counts the invoice IDs
+// that appear more than once and MissingInvoiceIDs the invoices without an ID;
+// both are left out of every KPI since their payments cannot be linked.
+type KPIResponse struct {
+	From              string            `json:"from"`
+	To                string            `json:"to"`
+	Summary           KPIValues         `json:"summary"`
+	Trend             []KPIPeriod       `json:"trend"`
+	Customers         []CustomerPayTime `json:"customers"`
+	DuplicateInvoices int               `json:"duplicateInvoices"`
+	MissingInvoiceIDs int               `json:"missingInvoiceIds"`
+}
+
+// KPIValues are the receivables KPIs for one period. A KPI is nil when it is
+// undefined for the period, e.g. DSO without any credit sales.
+//
+//   - DSO is closing AR / credit sales × days in the period.
+//   - CEI is (opening AR + credit sales − closing AR) /
+//     (opening AR + credit sales − closing current AR) × 100, where current AR is
+//     the part of closing AR that is not yet due.
+//   - AvgDaysToPay is the amount-weighted average number of days between invoice
+//     date and payment date of the payments received in the period.
+type KPIValues struct {
+	DSO          *string `json:"dso"`
+	CEI          *string `json:"cei"`
+	AvgDaysToPay *string `json:"avgDaysToPay"`
+	CreditSales  string  `json:"creditSales"`
+	Collections  string  `json:"collections"`
+	OpeningAR    string  `json:"openingAR"`
+	ClosingAR    string  `json:"closingAR"`
+}
+
+// KPIPeriod is one month of the KPI trend, clipped to the requested range.
+type KPIPeriod struct {
+	Period string `json:"period"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	KPIValues
+}
+
+// CustomerPayTime is the average days to pay of one customer within the period.
+type CustomerPayTime struct {
+	Customer     string  `json:"customer"`
+	Payments     int     `json:"payments"`
+	AvgDaysToPay *string `json:"avgDaysToPay"`
+}
+
+type kpiInvoice struct {
+	customer    string
+	issued, due time.Time
+	hasDueDate  bool
+	total       *big.Rat
+	payments    []kpiPayment
+}
+
+type kpiPayment struct {
+	date   time.Time
+	amount *big.Rat
+}
+
+// RunKPIs computes DSO, the Collection Effectiveness Index and average days to pay
+// from an invoices and a payments dataset. Payments are linked to invoices by ID;
+// payments without a known invoice or a valid date are ignored. Ranges longer
+// than MaxKPIMonths are rejected.
+func RunKPIs(ctx context.Context, req KPIRequest) (KPIResponse, error) {
+	from, ok := parseDate(req.From)
+	if !ok {
+		return KPIResponse{}, fmt.Errorf("invalid from date: %s", req.From)
+	}
+	to, ok := parseDate(req.To)
+	if !ok || to.Before(from) {
+		return KPIResponse{}, fmt.Errorf("invalid to date: %s", req.To)
+	}
+	if months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1; months > MaxKPIMonths {
+		return KPIResponse{}, fmt.Errorf("invalid range: %d months exceeds the maximum of %d", months, MaxKPIMonths)
+	}
+
+	ic := req.InvoiceColumns.withDefaults()
+	pc := req.PaymentColumns.withDefaults()
+	excluded := req.ExcludeStatuses
+	if excluded == nil {
+		excluded = DefaultExcludedStatuses
+	}
+
+	var ids []string
+	byID := make(map[string][]*kpiInvoice)
+	missingIDs := 0
+	_, err := forEachRow(ctx, req.InvoicesPath, []string{ic.ID, ic.Customer, ic.InvoiceDate, ic.DueDate, ic.Total, ic.Status}, nil, func(v []string) error {
+		if hasStatus(excluded, v[5]) {
+			return nil
+		}
+		issued, ok := parseDate(v[2])
+		if !ok {
+			return nil
+		}
+		inv := &kpiInvoice{customer: v[1], issued: issued}
+		inv.due, inv.hasDueDate = parseDate(v[3])
+		inv.total = parseAmount(v[4])
+		if v[0] == "" {
+			missingIDs++
+			return nil
+		}
+		if _, ok := byID[v[0]]; !ok {
+			ids = append(ids, v[0])
+		}
+		byID[v[0]] = append(byID[v[0]], inv)
+		return nil
+	})
+	if err != nil {
+		return KPIResponse{}, fmt.Errorf("invoices: %w", err)
+	}
+
+	// A payment for a repeated invoice ID cannot be assigned to one of the
+	// invoices, so none of them count.
+	invoices := make(map[string]*kpiInvoice, len(ids))
+	order := make([]*kpiInvoice, 0, len(ids))
+	duplicates := 0
+	for _, id := range ids {
+		if invs := byID[id]; len(invs) > 1 {
+			duplicates++
+			continue
+		}
+		invoices[id] = byID[id][0]
+		order = append(order, byID[id][0])
+	}
+
+	_, err = forEachRow(ctx, req.PaymentsPath, []string{pc.InvoiceID, pc.PaymentDate, pc.Amount}, nil, func(v []string) error {
+		inv, ok := invoices[v[0]]
+		if !ok {
+			return nil
+		}
+		date, ok := parseDate(v[1])
+		if !ok {
+			return nil
+		}
+		inv.payments = append(inv.payments, kpiPayment{date: date, amount: parseAmount(v[2])})
+		return nil
+	})
+	if err != nil {
+		return KPIResponse{}, fmt.Errorf("payments: %w", err)
+	}
+
+	resp := KPIResponse{
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		Summary: computeKPIs(order, from, to),
+		Trend:   []KPIPeriod{},
+
+		DuplicateInvoices: duplicates,
+		MissingInvoiceIDs: missingIDs,
+	}
+	for m := truncateDate(from, GrainMonth); !m.After(to); m = addPeriods(m, GrainMonth, 1) {
+		if err := contextError(ctx); err != nil {
+			return KPIResponse{}, err
+		}
+		start := maxTime(m, from)
+		end := minTime(addPeriods(m, GrainMonth, 1).AddDate(0, 0, -1), to)
+		resp.Trend = append(resp.Trend, KPIPeriod{
+			Period:    periodLabel(m, GrainMonth),
+			From:      start.Format("2006-01-02"),
+			To:        end.Format("2006-01-02"),
+			KPIValues: computeKPIs(order, start, end),
+		})
+	}
+	resp.Customers = customerPayTimes(order, from, to)
+	return resp, nil
+}
+
+func computeKPIs(invoices []*kpiInvoice, from, to time.Time) KPIValues {
+	openingAR := receivables(invoices, from.AddDate(0, 0, -1), false)
+	closingAR := receivables(invoices, to, false)
+	currentAR := receivables(invoices, to, true)
+
+	sales, collections, weightedDays := new(big.Rat), new(big.Rat), new(big.Rat)
+	for _, inv := range invoices {
+		if !inv.issued.Before(from) && !inv.issued.After(to) {
+			sales.Add(sales, inv.total)
+		}
+		for _, p := range inv.payments {
+			if p.date.Before(from) || p.date.After(to) {
+				continue
+			}
+			collections.Add(collections, p.amount)
+			weightedDays.Add(weightedDays, daysTimes(daysBetween(inv.issued, p.date), p.amount))
+		}
+	}
+
+	values := KPIValues{
+		CreditSales: formatAmount(sales),
+		Collections: formatAmount(collections),
+		OpeningAR:   formatAmount(openingAR),
+		ClosingAR:   formatAmount(closingAR),
+	}
+	if sales.Sign() > 0 {
+		days := daysBetween(from, to) + 1
+		dso := new(big.Rat).Quo(closingAR, sales)
+		values.DSO = formatOptional(dso.Mul(dso, big.NewRat(int64(days), 1)))
+	}
+	base := new(big.Rat).Add(openingAR, sales)
+	if denom := new(big.Rat).Sub(base, currentAR); denom.Sign() > 0 {
+		cei := new(big.Rat).Sub(base, closingAR)
+		cei.Quo(cei, denom)
+		values.CEI = formatOptional(cei.Mul(cei, big.NewRat(100, 1)))
+	}
+	if collections.Sign() > 0 {
+		values.AvgDaysToPay = formatOptional(new(big.Rat).Quo(weightedDays, collections))
+	}
+	return values
+}
+
+// receivables returns the amount outstanding at the end of day asOf over all
+// invoices issued by then. With onlyCurrent, invoices already past due are skipped.
+func receivables(invoices []*kpiInvoice, asOf time.Time, onlyCurrent bool) *big.Rat {
+	total := new(big.Rat)
+	for _, inv := range invoices {
+		if inv.issued.After(asOf) {
+			continue
+		}
+		if onlyCurrent && inv.hasDueDate && !inv.due.After(asOf) {
+			continue
+		}
+		outstanding := new(big.Rat).Set(inv.total)
+		for _, p := range inv.payments {
+			if !p.date.After(asOf) {
+				outstanding.Sub(outstanding, p.amount)
+			}
+		}
+		if outstanding.Sign() > 0 {
+			total.Add(total, outstanding)
+		}
+	}
+	return total
+}
+
+func customerPayTimes(invoices []*kpiInvoice, from, to time.Time) []CustomerPayTime {
+	type acc struct {
+		payments          int
+		weighted, amounts big.Rat
+	}
+	byCustomer := make(map[string]*acc)
+	var names []string
+	for _, inv := range invoices {
+		for _, p := range inv.payments {
+			if p.date.Before(from) || p.date.After(to) {
+				continue
+			}
+			a, ok := byCustomer[inv.customer]
+			if !ok {
+				a = &acc{}
+				byCustomer[inv.customer] = a
+				names = append(names, inv.customer)
+			}
+			a.payments++
+			a.weighted.Add(&a.weighted, daysTimes(daysBetween(inv.issued, p.date), p.amount))
+			a.amounts.Add(&a.amounts, p.amount)
+		}
+	}
+
+	out := make([]CustomerPayTime, 0, len(names))
+	for _, name := range names {
+		a := byCustomer[name]
+		row := CustomerPayTime{Customer: name, Payments: a.payments}
+		if a.amounts.Sign() > 0 {
+			row.AvgDaysToPay = formatOptional(new(big.Rat).Quo(&a.weighted, &a.amounts))
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func formatOptional(v *big.Rat) *string {
+	s := formatAmount(v)
+	return &s
+}
+
+// daysTimes returns an amount weighted by a number of days.
+func daysTimes(days int, amount *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(big.NewRat(int64(days), 1), amount)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunKPIs(t *testing.T) {
+	tmpDir := t.TempDir()
+	invoicesPath := filepath.Join(tmpDir, "invoices.csv")
+	paymentsPath := filepath.Join(tmpDir, "payments.csv")
+	invoices := `invoice_id,customer_name,invoice_date,due_date,total,status
+INV-0,Acme,2025-12-15,2026-01-14,100.00,Sent
+INV-1,Acme,2026-01-01,2026-01-31,300.00,Sent
+INV-2,Globex,2026-01-10,2026-02-28,600.00,Sent
+INV-3,Globex,2026-01-20,2026-02-19,999.00,Draft
+INV-4,Globex,2026-02-05,2026-03-07,200.00,Sent
+`
+	payments := `invoice_id,payment_date,amount
+INV-0,2026-01-05,100.00
+INV-1,2026-01-11,300.00
+INV-2,2026-02-09,300.00
+INV-9,2026-01-15,50.00
+`
+	if err := os.WriteFile(invoicesPath, []byte(invoices), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paymentsPath, []byte(payments), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := RunKPIs(context.Background(), KPIRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath, From: "2026-01-01", To: "2026-01-31"})
+	if err != nil {
+		t.Fatalf("RunKPIs failed: %v", err)
+	}
+
+	s := resp.Summary
+	// Opening AR 100, sales 900, closing AR 600 of which 600 is not yet due.
+	if s.OpeningAR != "100.00" || s.CreditSales != "900.00" || s.ClosingAR != "600.00" || s.Collections != "400.00" {
+		t.Errorf("unexpected balances: %+v", s)
+	}
+	// DSO = 600 / 900 * 31
+	if s.DSO == nil || *s.DSO != "20.67" {
+		t.Errorf("expected DSO 20.67, got %v", s.DSO)
+	}
+	// CEI = (100 + 900 - 600) / (100 + 900 - 600) * 100
+	if s.CEI == nil || *s.CEI != "100.00" {
+		t.Errorf("expected CEI 100.00, got %v", s.CEI)
+	}
+	// (21 days * 100 + 10 days * 300) / 400
+	if s.AvgDaysToPay == nil || *s.AvgDaysToPay != "12.75" {
+		t.Errorf("expected avg days to pay 12.75, got %v", s.AvgDaysToPay)
+	}
+
+	if len(resp.Trend) != 1 || resp.Trend[0].Period != "2026-01" {
+		t.Errorf("expected a single January trend period, got %+v", resp.Trend)
+	}
+	if len(resp.Customers) != 1 || resp.Customers[0].Customer != "Acme" || resp.Customers[0].Payments != 2 {
+		t.Errorf("unexpected customers: %+v", resp.Customers)
+	}
+
+	t.Run("monthly trend", func(t *testing.T) {
+		resp, err := RunKPIs(context.Background(), KPIRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath, From: "2026-01-15", To: "2026-03-10"})
+		if err != nil {
+			t.Fatalf("RunKPIs failed: %v", err)
+		}
+		if len(resp.Trend) != 3 {
+			t.Fatalf("expected 3 trend periods, got %d", len(resp.Trend))
+		}
+		first, last := resp.Trend[0], resp.Trend[2]
+		if first.From != "2026-01-15" || first.To != "2026-01-31" || last.From != "2026-03-01" || last.To != "2026-03-10" {
+			t.Errorf("expected trend clipped to range, got %s..%s and %s..%s", first.From, first.To, last.From, last.To)
+		}
+		if last.DSO != nil {
+			t.Errorf("expected no DSO without sales in March, got %s", *last.DSO)
+		}
+	})
+
+	t.Run("duplicate and missing invoice ids", func(t *testing.T) {
+		dupPath := filepath.Join(t.TempDir(), "invoices.csv")
+		content := invoices + "INV-1,Globex,2026-01-05,2026-02-04,700.00,Sent\n,Initech,2026-01-06,2026-02-05,50.00,Sent\n"
+		if err := os.WriteFile(dupPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := RunKPIs(context.Background(), KPIRequest{InvoicesPath: dupPath, PaymentsPath: paymentsPath, From: "2026-01-01", To: "2026-01-31"})
+		if err != nil {
+			t.Fatalf("RunKPIs failed: %v", err)
+		}
+		if resp.DuplicateInvoices != 1 || resp.MissingInvoiceIDs != 1 {
+			t.Errorf("expected 1 duplicate and 1 missing id, got %d and %d", resp.DuplicateInvoices, resp.MissingInvoiceIDs)
+		}
+		// Both INV-1 rows and their payment are left out.
+		s := resp.Summary
+		if s.CreditSales != "600.00" || s.Collections != "100.00" || s.ClosingAR != "600.00" {
+			t.Errorf("unexpected balances: %+v", s)
+		}
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		for _, r := range [][2]string{{"2026-02-01", "2026-01-01"}, {"2016-01-01", "2026-01-01"}} {
+			_, err := RunKPIs(context.Background(), KPIRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath, From: r[0], To: r[1]})
+			if err == nil {
+				t.Errorf("expected error for range %s..%s, got nil", r[0], r[1])
+			}
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), -1)
+		defer cancel()
+		_, err := RunKPIs(ctx, KPIRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath, From: "2026-01-01", To: "2026-01-31"})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+	})
+}
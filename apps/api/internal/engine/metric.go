@@ -0,0 +1,300 @@
+package engine
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// metricInfo is a Metric resolved against the report's columns.
+type metricInfo struct {
+	op       string
+	field    string
+	idx      int
+	scale    int
+	rounding string
+	fill     string
+	// percentile is the requested percentile of a percentile metric, and
+	// quantile the same as a fraction, 1/2 for a median.
+	percentile float64
+	quantile   *big.Rat
+	// approximate selects the sketches of an approximate report, and sampled is
+	// set when only a sample of the rows is aggregated. weight scales counts and
+	// sums of a sample up to the whole file.
+	approximate bool
+	sampled     bool
+	weight      *big.Rat
+}
+
+// aggState accumulates one metric of one group. Sums are exact decimals.
+type aggState struct {
+	sum   big.Rat
+	count int64
+	// sumSq is the sum of the squared amounts of a sampled sum or avg, for its
+	// error bound.
+	sumSq float64
+	// distinct and values hold every value of an exact count_distinct and of an
+	// exact median or percentile; hll and kll sketch them instead in an
+	// approximate report.
+	distinct map[string]struct{}
+	values   []*big.Rat
+	hll      *hyperLogLog
+	kll      *kllSketch
+	// size estimates the memory of the values and sketches.
+	size int64
+}
+
+func compileMetrics(headerMap map[string]int, reqMetrics []Metric) ([]metricInfo, error) {
+	var metrics []metricInfo
+	for _, m := range reqMetrics {
+		idx := -1
+		if m.Field != "" {
+			var ok bool
+			idx, ok = headerMap[m.Field]
+			if !ok {
+				return nil, fmt.Errorf("invalid metric field: %s", m.Field)
+			}
+		}
+		scale := DefaultScale
+		if m.Scale != nil {
+			scale = *m.Scale
+			if scale < 0 || scale > 18 {
+				return nil, fmt.Errorf("invalid metric scale: %d", scale)
+			}
+		}
+		if !validRounding(m.Rounding) {
+			return nil, fmt.Errorf("invalid rounding mode: %s", m.Rounding)
+		}
+		fill := defaultString(m.Fill, FillZero)
+		if fill != FillZero && fill != FillNull && fill != FillPrevious {
+			return nil, fmt.Errorf("invalid metric fill: %s", m.Fill)
+		}
+		info := metricInfo{op: m.Op, field: m.Field, idx: idx, scale: scale, rounding: m.Rounding, fill: fill}
+		switch m.Op {
+		case "count_distinct", "median", "percentile":
+			if m.Field == "" {
+				return nil, fmt.Errorf("invalid metric: %s needs a field", m.Op)
+			}
+		}
+		switch m.Op {
+		case "median":
+			info.quantile = big.NewRat(1, 2)
+		case "percentile":
+			if m.Percentile == nil || !(*m.Percentile >= 0 && *m.Percentile <= 100) {
+				return nil, fmt.Errorf("invalid metric percentile: percentile(%s) needs a percentile from 0 to 100", m.Field)
+			}
+			info.percentile = *m.Percentile
+			info.quantile, _ = new(big.Rat).SetString(strconv.FormatFloat(info.percentile, 'f', -1, 64))
+			info.quantile.Quo(info.quantile, big.NewRat(100, 1))
+		}
+		metrics = append(metrics, info)
+	}
+	return metrics, nil
+}
+
+// amounts reports whether the metric aggregates amounts, which currency
+// conversion applies to.
+func (m metricInfo) amounts() bool {
+	switch m.op {
+	case "sum", "avg", "median", "percentile":
+		return true
+	}
+	return false
+}
+
+// add folds a row into st, taking its amount from typed when that has one. A
+// non-nil rate converts the amount into the reporting currency, and rows without
+// a rate are left out of amount metrics. val is scratch space reused across
+// calls.
+func (m metricInfo) add(st *aggState, row []string, typed typedValues, rate *big.Rat, hasRate bool, val *big.Rat) {
+	switch m.op {
+	case "count":
+		st.count++
+	case "count_distinct":
+		// Like SQL, empty values are not counted.
+		if m.idx >= len(row) || row[m.idx] == "" {
+			return
+		}
+		st.count++
+		if m.approximate {
+			if st.hll == nil {
+				st.hll = &hyperLogLog{}
+			}
+			size := st.hll.bytes()
+			st.hll.add(hashString(row[m.idx]))
+			st.size += st.hll.bytes() - size
+			return
+		}
+		if _, ok := st.distinct[row[m.idx]]; ok {
+			return
+		}
+		if st.distinct == nil {
+			st.distinct = make(map[string]struct{})
+		}
+		// Clone the value, which shares its memory with the whole record.
+		st.distinct[strings.Clone(row[m.idx])] = struct{}{}
+		st.size += distinctBytes + int64(len(row[m.idx]))
+	case "sum", "avg", "median", "percentile":
+		if m.idx >= len(row) || !hasRate {
+			return
+		}
+		ok, known := false, false
+		if typed != nil {
+			ok, known = typed.decimal(m.idx, val)
+		}
+		if !known {
+			ok = csvutil.InferDecimal(row[m.idx], val)
+		}
+		if !ok {
+			return
+		}
+		if rate != nil {
+			val.Mul(val, rate)
+		}
+		st.count++
+		switch {
+		case m.quantile == nil:
+			st.sum.Add(&st.sum, val)
+			if m.sampled {
+				f, _ := val.Float64()
+				st.sumSq += f * f
+			}
+		case m.approximate:
+			if st.kll == nil {
+				st.kll = &kllSketch{}
+			}
+			size := st.kll.bytes()
+			f, _ := val.Float64()
+			st.kll.add(f)
+			st.size += st.kll.bytes() - size
+		default:
+			st.values = append(st.values, new(big.Rat).Set(val))
+			st.size += valueBytes
+		}
+	}
+}
+
+// merge folds the state of the same metric and group in another chunk into st.
+func (st *aggState) merge(part *aggState) {
+	st.sum.Add(&st.sum, &part.sum)
+	st.count += part.count
+	st.sumSq += part.sumSq
+	for v := range part.distinct {
+		if _, ok := st.distinct[v]; ok {
+			continue
+		}
+		if st.distinct == nil {
+			st.distinct = make(map[string]struct{})
+		}
+		st.distinct[v] = struct{}{}
+		st.size += distinctBytes + int64(len(v))
+	}
+	st.values = append(st.values, part.values...)
+	st.size += valueBytes * int64(len(part.values))
+	if part.hll != nil {
+		if st.hll == nil {
+			st.hll = &hyperLogLog{}
+		}
+		size := st.hll.bytes()
+		st.hll.merge(part.hll)
+		st.size += st.hll.bytes() - size
+	}
+	if part.kll != nil {
+		if st.kll == nil {
+			st.kll = &kllSketch{}
+		}
+		size := st.kll.bytes()
+		st.kll.merge(part.kll)
+		st.size += st.kll.bytes() - size
+	}
+}
+
+// name is the result column of the metric, e.g. "sum(amount)" or
+// "percentile(amount,95)".
+func (m metricInfo) name() string {
+	switch {
+	case m.field == "":
+		return m.op
+	case m.op == "percentile":
+		return m.op + "(" + m.field + "," + strconv.FormatFloat(m.percentile, 'f', -1, 64) + ")"
+	}
+	return m.op + "(" + m.field + ")"
+}
+
+// value returns the final value of the metric, exact unless the report is
+// approximate.
+func (m metricInfo) value(st *aggState) *big.Rat {
+	switch m.op {
+	case "count":
+		return m.scaleUp(new(big.Rat).SetInt64(st.count))
+	case "count_distinct":
+		return new(big.Rat).SetInt64(st.distinctCount())
+	case "avg":
+		if st.count == 0 {
+			return new(big.Rat)
+		}
+		return new(big.Rat).Quo(&st.sum, new(big.Rat).SetInt64(st.count))
+	case "median", "percentile":
+		return m.quantileValue(st)
+	default:
+		return m.scaleUp(new(big.Rat).Set(&st.sum))
+	}
+}
+
+// scaleUp estimates the count or sum of the whole file from that of a sample.
+func (m metricInfo) scaleUp(x *big.Rat) *big.Rat {
+	if m.weight != nil {
+		x.Mul(x, m.weight)
+	}
+	return x
+}
+
+func (st *aggState) distinctCount() int64 {
+	if st.hll != nil {
+		return st.hll.estimate()
+	}
+	return int64(len(st.distinct))
+}
+
+// quantileValue returns the quantile of the amounts of st. Exact quantiles
+// interpolate linearly between the two closest values, as spreadsheets do.
+func (m metricInfo) quantileValue(st *aggState) *big.Rat {
+	if st.kll != nil {
+		f, _ := m.quantile.Float64()
+		if x := new(big.Rat).SetFloat64(st.kll.quantile(f)); x != nil {
+			return x
+		}
+		return new(big.Rat)
+	}
+	if len(st.values) == 0 {
+		return new(big.Rat)
+	}
+	slices.SortFunc(st.values, (*big.Rat).Cmp)
+	pos := new(big.Rat).Mul(m.quantile, new(big.Rat).SetInt64(int64(len(st.values)-1)))
+	lo := new(big.Int).Quo(pos.Num(), pos.Denom())
+	i := int(lo.Int64())
+	x := new(big.Rat).Set(st.values[i])
+	if i+1 < len(st.values) {
+		frac := pos.Sub(pos, new(big.Rat).SetInt(lo))
+		step := new(big.Rat).Sub(st.values[i+1], st.values[i])
+		x.Add(x, step.Mul(step, frac))
+	}
+	return x
+}
+
+// format renders the final value of the metric.
+func (m metricInfo) format(st *aggState) string {
+	switch {
+	case m.op == "count_distinct":
+		return strconv.FormatInt(st.distinctCount(), 10)
+	case m.op == "count" && m.weight == nil:
+		return strconv.FormatInt(st.count, 10)
+	case m.op == "count":
+		return formatDecimal(m.value(st), 0, m.rounding)
+	}
+	return formatDecimal(m.value(st), m.scale, m.rounding)
+}
@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// MRR movement categories that subscription event types map to.
+const (
+	MovementNew          = "new"
+	MovementExpansion    = "expansion"
+	MovementContraction  = "contraction"
+	MovementChurn        = "churn"
+	MovementReactivation = "reactivation"
+)
+
+// DefaultMRREventTypes maps the event types of the bundled subscriptions sample
+// to MRR movements.
+var DefaultMRREventTypes = map[string]string{
+	"started":    MovementNew,
+	"upgraded":   MovementExpansion,
+	"downgraded": MovementContraction,
+	"canceled":   MovementChurn,
+	"cancelled":  MovementChurn,
+	"paused":     MovementChurn,
+	"resumed":    MovementReactivation,
+}
+
+// MRRRequest configures the monthly MRR movements analysis of a subscription
+// event log, where each event carries the subscription's MRR after the event.
+type MRRRequest struct {
+	// From and To optionally limit the months reported, as YYYY-MM or YYYY-MM-DD.
+	From    string     `json:"from"`
+	To      string     `json:"to"`
+	Columns MRRColumns `json:"columns"`
+	// EventTypes maps event type values to movement categories. Defaults to
+	// DefaultMRREventTypes.
+	EventTypes map[string]string `json:"eventTypes"`
+}
+
+// MRRColumns maps event fields to dataset columns. They default to the columns of
+// the bundled subscriptions sample.
+type MRRColumns struct {
+	Subscription string `json:"subscription"`
+	Date         string `json:"date"`
+	EventType    string `json:"eventType"`
+	MRR          string `json:"mrr"`
+}
+
+// MRRResponse is the MRR waterfall per month. Event types without a mapping are
+// classified as expansion or contraction by the direction of the change and are
+// listed in UnmappedEventTypes.
+type MRRResponse struct {
+	Months             []MRRMonth `json:"months"`
+	UnmappedEventTypes []string   `json:"unmappedEventTypes"`
+}
+
+// MRRMonth is one month of the waterfall. Contraction and Churned are negative,
+// so Ending = Starting + New + Expansion + Contraction + Churned + Reactivation.
+type MRRMonth struct {
+	Month        string `json:"month"`
+	Starting     string `json:"starting"`
+	New          string `json:"new"`
+	Expansion    string `json:"expansion"`
+	Contraction  string `json:"contraction"`
+	Churned      string `json:"churned"`
+	Reactivation string `json:"reactivation"`
+	Ending       string `json:"ending"`
+}
+
+type mrrEvent struct {
+	subscription, eventType string
+	date                    time.Time
+	mrr                     *big.Rat
+}
+
+type mrrMovements struct {
+	newMRR, expansion, contraction, churned, reactivation big.Rat
+}
+
+func (mv *mrrMovements) net() *big.Rat {
+	net := new(big.Rat).Add(&mv.newMRR, &mv.expansion)
+	net.Add(net, &mv.contraction)
+	net.Add(net, &mv.churned)
+	return net.Add(net, &mv.reactivation)
+}
+
+// RunMRR computes starting MRR, new, expansion, contraction, churned and
+// reactivation MRR, and ending MRR for every month of a subscription event log.
+// Events are applied in date order, keeping file order for events on the same day.
+func RunMRR(ctx context.Context, filePath string, req MRRRequest) (MRRResponse, error) {
+	eventTypes := req.EventTypes
+	if eventTypes == nil {
+		eventTypes = DefaultMRREventTypes
+	}
+	for t, m := range eventTypes {
+		switch m {
+		case MovementNew, MovementExpansion, MovementContraction, MovementChurn, MovementReactivation:
+		default:
+			return MRRResponse{}, fmt.Errorf("invalid movement %q for event type %q", m, t)
+		}
+	}
+	from, to, err := parseMonthRange(req.From, req.To)
+	if err != nil {
+		return MRRResponse{}, err
+	}
+
+	c := req.Columns
+	columns := []string{
+		defaultString(c.Subscription, "subscription_id"),
+		defaultString(c.Date, "event_date"),
+		defaultString(c.EventType, "event_type"),
+		defaultString(c.MRR, "mrr"),
+	}
+	var events []mrrEvent
+	_, err = forEachRow(ctx, filePath, columns, nil, func(v []string) error {
+		date, ok := parseDate(v[1])
+		if !ok {
+			return nil
+		}
+		events = append(events, mrrEvent{subscription: v[0], date: date, eventType: v[2], mrr: parseAmount(v[3])})
+		return nil
+	})
+	if err != nil {
+		return MRRResponse{}, err
+	}
+
+	resp := MRRResponse{Months: []MRRMonth{}, UnmappedEventTypes: []string{}}
+	if len(events) == 0 {
+		return resp, nil
+	}
+	slices.SortStableFunc(events, func(a, b mrrEvent) int { return a.date.Compare(b.date) })
+
+	current := make(map[string]*big.Rat)
+	byMonth := make(map[time.Time]*mrrMovements)
+	unmapped := make(map[string]bool)
+	for _, e := range events {
+		delta := new(big.Rat).Set(e.mrr)
+		if prev, ok := current[e.subscription]; ok {
+			delta.Sub(delta, prev)
+		}
+		current[e.subscription] = e.mrr
+
+		month := truncateDate(e.date, GrainMonth)
+		mv, ok := byMonth[month]
+		if !ok {
+			mv = &mrrMovements{}
+			byMonth[month] = mv
+		}
+
+		movement, ok := eventTypes[e.eventType]
+		if !ok {
+			unmapped[e.eventType] = true
+		}
+		var dst *big.Rat
+		switch {
+		case movement == MovementNew:
+			dst = &mv.newMRR
+		case movement == MovementChurn:
+			dst = &mv.churned
+		case movement == MovementReactivation:
+			dst = &mv.reactivation
+		case delta.Sign() >= 0:
+			dst = &mv.expansion
+		default:
+			dst = &mv.contraction
+		}
+		dst.Add(dst, delta)
+	}
+
+	first := truncateDate(events[0].date, GrainMonth)
+	last := truncateDate(events[len(events)-1].date, GrainMonth)
+	if !from.IsZero() && from.After(first) {
+		first = from
+	}
+	if !to.IsZero() && to.Before(last) {
+		last = to
+	}
+
+	running := new(big.Rat)
+	for m := truncateDate(events[0].date, GrainMonth); !m.After(last); m = addPeriods(m, GrainMonth, 1) {
+		mv := byMonth[m]
+		if mv == nil {
+			mv = &mrrMovements{}
+		}
+		starting := new(big.Rat).Set(running)
+		running.Add(running, mv.net())
+		if m.Before(first) {
+			continue
+		}
+		resp.Months = append(resp.Months, MRRMonth{
+			Month:        periodLabel(m, GrainMonth),
+			Starting:     formatAmount(starting),
+			New:          formatAmount(&mv.newMRR),
+			Expansion:    formatAmount(&mv.expansion),
+			Contraction:  formatAmount(&mv.contraction),
+			Churned:      formatAmount(&mv.churned),
+			Reactivation: formatAmount(&mv.reactivation),
+			Ending:       formatAmount(running),
+		})
+	}
+	resp.UnmappedEventTypes = slices.Sorted(maps.Keys(unmapped))
+	return resp, nil
+}
+
+// parseMonthRange parses optional range bounds given as months or dates and
+// returns the first day of each bound's month. Missing bounds are zero.
+func parseMonthRange(from, to string) (time.Time, time.Time, error) {
+	parse := func(s string) (time.Time, error) {
+		if s == "" {
+			return time.Time{}, nil
+		}
+		if t, err := time.Parse("2006-01", s); err == nil {
+			return t, nil
+		}
+		if t, ok := parseDate(s); ok {
+			return truncateDate(t, GrainMonth), nil
+		}
+		return time.Time{}, fmt.Errorf("invalid month: %s", s)
+	}
+	f, err := parse(from)
+	if err != nil {
+		return f, f, err
+	}
+	t, err := parse(to)
+	return f, t, err
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunMRR(t *testing.T) {
+	csvContent := `subscription_id,event_date,event_type,mrr
+s1,2026-01-05,started,100
+s2,2026-01-20,started,50
+s1,2026-02-10,upgraded,150
+s2,2026-02-15,downgraded,30
+s3,2026-02-20,started,20
+s2,2026-03-01,canceled,0
+s1,2026-03-02,paused,0
+s1,2026-03-25,resumed,150
+s3,2026-03-28,migrated,25
+`
+	csvPath := filepath.Join(t.TempDir(), "subscriptions.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := RunMRR(context.Background(), csvPath, MRRRequest{})
+	if err != nil {
+		t.Fatalf("RunMRR failed: %v", err)
+	}
+	if len(resp.Months) != 3 {
+		t.Fatalf("expected 3 months, got %d", len(resp.Months))
+	}
+
+	expected := []MRRMonth{
+		{Month: "2026-01", Starting: "0.00", New: "150.00", Expansion: "0.00", Contraction: "0.00", Churned: "0.00", Reactivation: "0.00", Ending: "150.00"},
+		{Month: "2026-02", Starting: "150.00", New: "20.00", Expansion: "50.00", Contraction: "-20.00", Churned: "0.00", Reactivation: "0.00", Ending: "200.00"},
+		{Month: "2026-03", Starting: "200.00", New: "0.00", Expansion: "5.00", Contraction: "0.00", Churned: "-180.00", Reactivation: "150.00", Ending: "175.00"},
+	}
+	for i, want := range expected {
+		if resp.Months[i] != want {
+			t.Errorf("month %d: expected %+v, got %+v", i, want, resp.Months[i])
+		}
+	}
+	if len(resp.UnmappedEventTypes) != 1 || resp.UnmappedEventTypes[0] != "migrated" {
+		t.Errorf("expected unmapped [migrated], got %v", resp.UnmappedEventTypes)
+	}
+
+	t.Run("month range keeps running balance", func(t *testing.T) {
+		resp, err := RunMRR(context.Background(), csvPath, MRRRequest{From: "2026-02", To: "2026-02-28"})
+		if err != nil {
+			t.Fatalf("RunMRR failed: %v", err)
+		}
+		if len(resp.Months) != 1 || resp.Months[0].Starting != "150.00" {
+			t.Errorf("expected only February starting at 150.00, got %+v", resp.Months)
+		}
+	})
+
+	t.Run("custom mapping", func(t *testing.T) {
+		resp, err := RunMRR(context.Background(), csvPath, MRRRequest{EventTypes: map[string]string{
+			"started": MovementNew, "upgraded": MovementExpansion, "downgraded": MovementContraction,
+			"canceled": MovementChurn, "paused": MovementChurn, "resumed": MovementReactivation, "migrated": MovementNew,
+		}})
+		if err != nil {
+			t.Fatalf("RunMRR failed: %v", err)
+		}
+		if len(resp.UnmappedEventTypes) != 0 || resp.Months[2].New != "5.00" {
+			t.Errorf("expected migrated to count as new MRR, got %+v", resp.Months[2])
+		}
+	})
+
+	t.Run("invalid mapping", func(t *testing.T) {
+		if _, err := RunMRR(context.Background(), csvPath, MRRRequest{EventTypes: map[string]string{"started": "growth"}}); err == nil {
+			t.Error("expected error for invalid movement, got nil")
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"io"
+	"time"
+)
+
+// ProgressInterval is the number of CSV rows between two progress reports and
+// cancellation checks of a running report.
+const ProgressInterval = 10000
+
+// PartialRows is the number of rows in the partial results of a sorted report
+// without a limit.
+const PartialRows = 10
+
+// PartialInterval is the least time between two partial results. Each one
+// formats and sorts every group found so far, so progress reports in between
+// go without.
+var PartialInterval = time.Second
+
+// Progress is a snapshot of a running report. Groups counts the groups found so
+// far. Partial holds the top rows so far when the report is sorted, at most once
+// per PartialInterval.
+type Progress struct {
+	RowsScanned int             `json:"rowsScanned"`
+	BytesRead   int64           `json:"bytesRead"`
+	TotalBytes  int64           `json:"totalBytes"`
+	Groups      int             `json:"groups"`
+	Partial     *ReportResponse `json:"partial,omitempty"`
+}
+
+// Percent returns the share of the file read so far, from 0 to 100.
+func (p Progress) Percent() float64 {
+	if p.TotalBytes <= 0 {
+		return 0
+	}
+	return min(100, float64(p.BytesRead)*100/float64(p.TotalBytes))
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,377 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Invoice payment statuses assigned by Reconcile.
+const (
+	InvoiceFullyPaid     = "fully_paid"
+	InvoicePartiallyPaid = "partially_paid"
+	InvoiceOverpaid      = "overpaid"
+	InvoiceUnpaid        = "unpaid"
+)
+
+// Exception types listed by Reconcile in addition to the invoice statuses above.
+const (
+	ExceptionOrphanPayment    = "orphan_payment"
+	ExceptionCurrencyMismatch = "currency_mismatch"
+	ExceptionFuzzyMatch       = "fuzzy_match"
+	ExceptionAmbiguousMatch   = "ambiguous_match"
+	ExceptionDuplicateInvoice = "duplicate_invoice"
+)
+
+// ReconcileRequest matches the payments of one dataset to the invoices of another.
+// Column names default to those of the bundled invoice and payment samples.
+type ReconcileRequest struct {
+	InvoicesReportID string `json:"invoicesReportId"`
+	PaymentsReportID string `json:"paymentsReportId"`
+	// InvoicesPath and PaymentsPath are the CSV files backing the report IDs.
+	// They are resolved by the caller.
+	InvoicesPath string `json:"-"`
+	PaymentsPath string `json:"-"`
+
+	InvoiceColumns InvoiceColumns `json:"invoiceColumns"`
+	PaymentColumns PaymentColumns `json:"paymentColumns"`
+
+	// FuzzyMatch assigns payments whose invoice ID is missing or unknown to the
+	// one invoice whose ID is a word of the payment reference, or else to the only
+	// open invoice in the same currency whose outstanding amount equals the payment
+	// amount. Payments that fit several invoices are reported as ambiguous.
+	FuzzyMatch bool `json:"fuzzyMatch"`
+	// Tolerance is the largest amount difference still treated as equal. Defaults to 0.005.
+	Tolerance float64 `json:"tolerance"`
+}
+
+// InvoiceColumns maps invoice fields to dataset columns.
+type InvoiceColumns struct {
+	ID          string `json:"id"`
+	Customer    string `json:"customer"`
+	InvoiceDate string `json:"invoiceDate"`
+	DueDate     string `json:"dueDate"`
+	Total       string `json:"total"`
+	Currency    string `json:"currency"`
+	Status      string `json:"status"`
+}
+
+// PaymentColumns maps payment fields to dataset columns.
+type PaymentColumns struct {
+	ID          string `json:"id"`
+	InvoiceID   string `json:"invoiceId"`
+	PaymentDate string `json:"paymentDate"`
+	Amount      string `json:"amount"`
+	Currency    string `json:"currency"`
+	Reference   string `json:"reference"`
+}
+
+// ReconcileResponse summarizes a reconciliation and lists every item needing attention.
+type ReconcileResponse struct {
+	Summary    ReconcileSummary     `json:"summary"`
+	Exceptions []ReconcileException `json:"exceptions"`
+}
+
+// ReconcileSummary counts invoices by payment status and payments by problem.
+type ReconcileSummary struct {
+	Invoices           int `json:"invoices"`
+	Payments           int `json:"payments"`
+	FullyPaid          int `json:"fullyPaid"`
+	PartiallyPaid      int `json:"partiallyPaid"`
+	Overpaid           int `json:"overpaid"`
+	Unpaid             int `json:"unpaid"`
+	OrphanPayments     int `json:"orphanPayments"`
+	CurrencyMismatches int `json:"currencyMismatches"`
+	FuzzyMatches       int `json:"fuzzyMatches"`
+	AmbiguousMatches   int `json:"ambiguousMatches"`
+	DuplicateInvoices  int `json:"duplicateInvoices"`
+}
+
+// ReconcileException is one invoice or payment that is not cleanly reconciled.
+// Expected and Received are the invoice total and matched payments for invoice
+// exceptions, and the payment amount for payment exceptions.
+type ReconcileException struct {
+	Type      string `json:"type"`
+	InvoiceID string `json:"invoiceId,omitempty"`
+	PaymentID string `json:"paymentId,omitempty"`
+	Customer  string `json:"customer,omitempty"`
+	Currency  string `json:"currency"`
+	Expected  string `json:"expected"`
+	Received  string `json:"received"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// ExceptionColumns is the header used when exporting exceptions as CSV.
+var ExceptionColumns = []string{"type", "invoice_id", "payment_id", "customer", "currency", "expected", "received", "detail"}
+
+// Record returns the exception as a CSV record matching ExceptionColumns.
+func (e ReconcileException) Record() []string {
+	return []string{e.Type, e.InvoiceID, e.PaymentID, e.Customer, e.Currency, e.Expected, e.Received, e.Detail}
+}
+
+type reconInvoice struct {
+	id, customer, currency string
+	total, paid            *big.Rat
+}
+
+type reconPayment struct {
+	id, invoiceID, currency, reference string
+	amount                             *big.Rat
+}
+
+// Reconcile matches payments to invoices and classifies each invoice as fully
+// paid, partially paid, overpaid or unpaid. Payments in a different currency than
+// their invoice are reported as mismatches and do not count towards the invoice.
+// Invoice IDs that appear more than once are reported, and payments for them are
+// reported as ambiguous rather than assigned to one of the invoices.
+func Reconcile(ctx context.Context, req ReconcileRequest) (ReconcileResponse, error) {
+	ic := req.InvoiceColumns.withDefaults()
+	pc := req.PaymentColumns.withDefaults()
+	// Compare with the exact decimal the tolerance was written as, 0.005 and not
+	// its nearest float.
+	tol := big.NewRat(5, 1000)
+	if req.Tolerance > 0 {
+		tol.SetString(strconv.FormatFloat(req.Tolerance, 'f', -1, 64))
+	}
+
+	var invoices []*reconInvoice
+	byID := make(map[string][]*reconInvoice)
+	_, err := forEachRow(ctx, req.InvoicesPath, []string{ic.ID, ic.Customer, ic.Total, ic.Currency}, nil, func(v []string) error {
+		inv := &reconInvoice{id: v[0], customer: v[1], total: parseAmount(v[2]), paid: new(big.Rat), currency: v[3]}
+		invoices = append(invoices, inv)
+		if inv.id != "" {
+			byID[inv.id] = append(byID[inv.id], inv)
+		}
+		return nil
+	})
+	if err != nil {
+		return ReconcileResponse{}, fmt.Errorf("invoices: %w", err)
+	}
+
+	var payments []reconPayment
+	_, err = forEachRow(ctx, req.PaymentsPath, []string{pc.ID, pc.InvoiceID, pc.Amount, pc.Currency, pc.Reference}, nil, func(v []string) error {
+		payments = append(payments, reconPayment{id: v[0], invoiceID: v[1], amount: parseAmount(v[2]), currency: v[3], reference: v[4]})
+		return nil
+	})
+	if err != nil {
+		return ReconcileResponse{}, fmt.Errorf("payments: %w", err)
+	}
+
+	resp := ReconcileResponse{Exceptions: []ReconcileException{}}
+	resp.Summary.Invoices = len(invoices)
+	resp.Summary.Payments = len(payments)
+
+	for _, inv := range invoices {
+		if dups := byID[inv.id]; len(dups) > 1 && dups[0] == inv {
+			resp.Summary.DuplicateInvoices++
+			resp.Exceptions = append(resp.Exceptions, ReconcileException{
+				Type:      ExceptionDuplicateInvoice,
+				InvoiceID: inv.id,
+				Customer:  inv.customer,
+				Currency:  inv.currency,
+				Expected:  formatAmount(inv.total),
+				Detail:    fmt.Sprintf("invoice id appears %d times", len(dups)),
+			})
+		}
+	}
+
+	// Exact matches are applied first so that fuzzy amount matching sees the
+	// outstanding balances left after them.
+	var unmatched []reconPayment
+	for _, p := range payments {
+		switch invs := byID[p.invoiceID]; len(invs) {
+		case 0:
+			unmatched = append(unmatched, p)
+		case 1:
+			applyPayment(&resp, invs[0], p, "")
+		default:
+			ambiguousPayment(&resp, p, "invoice id", invs)
+		}
+	}
+
+	var byRef map[string][]*reconInvoice
+	if req.FuzzyMatch {
+		byRef = make(map[string][]*reconInvoice)
+		for _, inv := range invoices {
+			if inv.id != "" {
+				id := strings.ToLower(inv.id)
+				byRef[id] = append(byRef[id], inv)
+			}
+		}
+	}
+	for _, p := range unmatched {
+		if req.FuzzyMatch {
+			invs, how := fuzzyMatch(invoices, byRef, p, tol)
+			if len(invs) == 1 {
+				applyPayment(&resp, invs[0], p, how)
+				continue
+			}
+			if len(invs) > 1 {
+				ambiguousPayment(&resp, p, how, invs)
+				continue
+			}
+		}
+		resp.Summary.OrphanPayments++
+		resp.Exceptions = append(resp.Exceptions, paymentException(ExceptionOrphanPayment, p, nil, "no matching invoice"))
+	}
+
+	for _, inv := range invoices {
+		status := classifyInvoice(inv, tol)
+		switch status {
+		case InvoiceFullyPaid:
+			resp.Summary.FullyPaid++
+			continue
+		case InvoicePartiallyPaid:
+			resp.Summary.PartiallyPaid++
+		case InvoiceOverpaid:
+			resp.Summary.Overpaid++
+		case InvoiceUnpaid:
+			resp.Summary.Unpaid++
+		}
+		resp.Exceptions = append(resp.Exceptions, ReconcileException{
+			Type:      status,
+			InvoiceID: inv.id,
+			Customer:  inv.customer,
+			Currency:  inv.currency,
+			Expected:  formatAmount(inv.total),
+			Received:  formatAmount(inv.paid),
+			Detail:    fmt.Sprintf("difference %s", formatAmount(new(big.Rat).Sub(inv.paid, inv.total))),
+		})
+	}
+	return resp, nil
+}
+
+func applyPayment(resp *ReconcileResponse, inv *reconInvoice, p reconPayment, fuzzy string) {
+	if fuzzy != "" {
+		resp.Summary.FuzzyMatches++
+		resp.Exceptions = append(resp.Exceptions, paymentException(ExceptionFuzzyMatch, p, inv, "matched by "+fuzzy))
+	}
+	if p.currency != "" && inv.currency != "" && !strings.EqualFold(p.currency, inv.currency) {
+		resp.Summary.CurrencyMismatches++
+		resp.Exceptions = append(resp.Exceptions, paymentException(ExceptionCurrencyMismatch, p, inv,
+			fmt.Sprintf("payment in %s, invoice in %s", p.currency, inv.currency)))
+		return
+	}
+	inv.paid.Add(inv.paid, p.amount)
+}
+
+// ambiguousPayment reports a payment that matches several invoices, by the
+// given criterion, and leaves it unassigned.
+func ambiguousPayment(resp *ReconcileResponse, p reconPayment, how string, invs []*reconInvoice) {
+	ids := make([]string, len(invs))
+	for i, inv := range invs {
+		ids[i] = inv.id
+	}
+	resp.Summary.AmbiguousMatches++
+	resp.Exceptions = append(resp.Exceptions, paymentException(ExceptionAmbiguousMatch, p, nil,
+		fmt.Sprintf("%s matches %d invoices: %s", how, len(invs), strings.Join(ids, ", "))))
+}
+
+// fuzzyMatch finds the invoices a payment without a usable invoice ID may pay
+// and reports how they were found: the invoices whose ID is a word of the
+// payment reference, or else the open invoices in its currency whose
+// outstanding amount equals the payment amount. byRef maps lowercase invoice IDs
+// to their invoices. Several invoices make the match ambiguous.
+func fuzzyMatch(invoices []*reconInvoice, byRef map[string][]*reconInvoice, p reconPayment, tol *big.Rat) ([]*reconInvoice, string) {
+	var matches []*reconInvoice
+	for _, word := range referenceWords(p.reference) {
+		for _, inv := range byRef[word] {
+			if !slices.Contains(matches, inv) {
+				matches = append(matches, inv)
+			}
+		}
+	}
+	if len(matches) > 0 {
+		return matches, "reference"
+	}
+
+	for _, inv := range invoices {
+		if !strings.EqualFold(inv.currency, p.currency) {
+			continue
+		}
+		outstanding := new(big.Rat).Sub(inv.total, inv.paid)
+		if withinTolerance(outstanding, p.amount, tol) {
+			matches = append(matches, inv)
+		}
+	}
+	return matches, "amount"
+}
+
+// referenceWords splits a payment reference into lowercase words of letters,
+// digits and the separators common in document numbers, so that "INV-10" is one
+// word and never matches invoice INV-1.
+func referenceWords(ref string) []string {
+	return strings.FieldsFunc(strings.ToLower(ref), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '/'
+	})
+}
+
+func classifyInvoice(inv *reconInvoice, tol *big.Rat) string {
+	switch {
+	case withinTolerance(inv.paid, inv.total, tol):
+		return InvoiceFullyPaid
+	case inv.paid.Cmp(inv.total) > 0:
+		return InvoiceOverpaid
+	case withinTolerance(inv.paid, new(big.Rat), tol):
+		return InvoiceUnpaid
+	default:
+		return InvoicePartiallyPaid
+	}
+}
+
+// withinTolerance reports whether a and b differ by at most tol.
+func withinTolerance(a, b, tol *big.Rat) bool {
+	diff := new(big.Rat).Sub(a, b)
+	return diff.Abs(diff).Cmp(tol) <= 0
+}
+
+func paymentException(typ string, p reconPayment, inv *reconInvoice, detail string) ReconcileException {
+	e := ReconcileException{
+		Type:      typ,
+		InvoiceID: p.invoiceID,
+		PaymentID: p.id,
+		Currency:  p.currency,
+		Received:  formatAmount(p.amount),
+		Detail:    detail,
+	}
+	if inv != nil {
+		e.InvoiceID = inv.id
+		e.Customer = inv.customer
+		e.Expected = formatAmount(inv.total)
+	}
+	return e
+}
+
+func (c InvoiceColumns) withDefaults() InvoiceColumns {
+	return InvoiceColumns{
+		ID:          defaultString(c.ID, "invoice_id"),
+		Customer:    defaultString(c.Customer, "customer_name"),
+		InvoiceDate: defaultString(c.InvoiceDate, "invoice_date"),
+		DueDate:     defaultString(c.DueDate, "due_date"),
+		Total:       defaultString(c.Total, "total"),
+		Currency:    defaultString(c.Currency, "currency"),
+		Status:      defaultString(c.Status, "status"),
+	}
+}
+
+func (c PaymentColumns) withDefaults() PaymentColumns {
+	return PaymentColumns{
+		ID:          defaultString(c.ID, "payment_id"),
+		InvoiceID:   defaultString(c.InvoiceID, "invoice_id"),
+		PaymentDate: defaultString(c.PaymentDate, "payment_date"),
+		Amount:      defaultString(c.Amount, "amount"),
+		Currency:    defaultString(c.Currency, "currency"),
+		Reference:   defaultString(c.Reference, "reference"),
+	}
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
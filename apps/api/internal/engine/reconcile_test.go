@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	tmpDir := t.TempDir()
+	invoicesPath := filepath.Join(tmpDir, "invoices.csv")
+	paymentsPath := filepath.Join(tmpDir, "payments.csv")
+	invoices := `invoice_id,customer_name,total,currency
+INV-1,Acme,100.00,USD
+INV-2,Acme,200.00,USD
+INV-3,Globex,300.00,EUR
+INV-4,Initech,400.00,USD
+INV-5,Umbrella,50.00,USD
+INV-6,Hooli,75.00,USD
+`
+	payments := `payment_id,invoice_id,amount,currency,reference
+P1,INV-1,100.00,USD,
+P2,INV-2,50.00,USD,
+P3,INV-3,300.00,USD,
+P4,INV-4,400.00,USD,
+P5,INV-4,1.00,USD,
+P6,,50.00,USD,
+P7,INV-99,10.00,USD,
+P8,,75.00,USD,for inv-6
+`
+	if err := os.WriteFile(invoicesPath, []byte(invoices), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paymentsPath, []byte(payments), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("exact matching", func(t *testing.T) {
+		resp, err := Reconcile(context.Background(), ReconcileRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath})
+		if err != nil {
+			t.Fatalf("Reconcile failed: %v", err)
+		}
+		expected := ReconcileSummary{
+			Invoices: 6, Payments: 8,
+			FullyPaid: 1, PartiallyPaid: 1, Overpaid: 1, Unpaid: 3,
+			OrphanPayments: 3, CurrencyMismatches: 1,
+		}
+		if resp.Summary != expected {
+			t.Errorf("expected summary %+v, got %+v", expected, resp.Summary)
+		}
+
+		types := map[string]string{}
+		for _, e := range resp.Exceptions {
+			if e.InvoiceID != "" && e.PaymentID == "" {
+				types[e.InvoiceID] = e.Type
+			}
+		}
+		if types["INV-2"] != InvoicePartiallyPaid || types["INV-4"] != InvoiceOverpaid || types["INV-3"] != InvoiceUnpaid {
+			t.Errorf("unexpected invoice exceptions: %v", types)
+		}
+	})
+
+	t.Run("fuzzy matching", func(t *testing.T) {
+		resp, err := Reconcile(context.Background(), ReconcileRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath, FuzzyMatch: true})
+		if err != nil {
+			t.Fatalf("Reconcile failed: %v", err)
+		}
+		// P6 matches INV-5 by amount, P8 matches INV-6 by reference; P7 stays orphaned.
+		if resp.Summary.FuzzyMatches != 2 || resp.Summary.OrphanPayments != 1 || resp.Summary.FullyPaid != 3 {
+			t.Errorf("unexpected summary: %+v", resp.Summary)
+		}
+	})
+
+	t.Run("whole ids and ambiguous matches", func(t *testing.T) {
+		invoicesPath := filepath.Join(tmpDir, "dup-invoices.csv")
+		paymentsPath := filepath.Join(tmpDir, "dup-payments.csv")
+		invoices := `invoice_id,customer_name,total,currency
+INV-1,Acme,100.00,USD
+INV-10,Globex,100.00,USD
+INV-7,Initech,70.00,USD
+INV-7,Initech,70.00,USD
+`
+		payments := `payment_id,invoice_id,amount,currency,reference
+P1,,100.00,USD,Payment INV-10.
+P2,INV-7,70.00,USD,
+P3,,5.00,USD,inv-1 and inv-10
+`
+		if err := os.WriteFile(invoicesPath, []byte(invoices), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(paymentsPath, []byte(payments), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := Reconcile(context.Background(), ReconcileRequest{InvoicesPath: invoicesPath, PaymentsPath: paymentsPath, FuzzyMatch: true})
+		if err != nil {
+			t.Fatalf("Reconcile failed: %v", err)
+		}
+		// P1 pays INV-10, not INV-1; P2 and P3 fit two invoices each.
+		if resp.Summary.FullyPaid != 1 || resp.Summary.AmbiguousMatches != 2 || resp.Summary.DuplicateInvoices != 1 || resp.Summary.OrphanPayments != 0 {
+			t.Errorf("unexpected summary: %+v", resp.Summary)
+		}
+		for _, e := range resp.Exceptions {
+			if e.Type == ExceptionFuzzyMatch && e.InvoiceID != "INV-10" {
+				t.Errorf("expected P1 to match INV-10, got %+v", e)
+			}
+		}
+	})
+
+	t.Run("invalid column mapping", func(t *testing.T) {
+		_, err := Reconcile(context.Background(), ReconcileRequest{
+			InvoicesPath:   invoicesPath,
+			PaymentsPath:   paymentsPath,
+			InvoiceColumns: InvoiceColumns{Total: "amount_due"},
+		})
+		if err == nil {
+			t.Error("expected error for invalid column, got nil")
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// Row change types emitted by DiffRows.
+const (
+	RowAdded   = "added"
+	RowDeleted = "deleted"
+	RowChanged = "changed"
+)
+
+// SortChunkRows bounds how many rows are sorted in memory at once when rows must
+// be put in key order. Larger inputs are spilled to temporary files.
+var SortChunkRows = 50000
+
+// RowChange describes one keyed row that differs between two datasets. Row holds
+// the full record for added and deleted rows; Fields holds the before/after
+// values of the columns that differ for changed rows.
+type RowChange struct {
+	Type   string                 `json:"type"`
+	Key    []string               `json:"key"`
+	Row    map[string]string      `json:"row,omitempty"`
+	Fields map[string]FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is the value of one column before and after a change.
+type FieldChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// RowDiffSummary counts the outcome of a row-level diff.
+type RowDiffSummary struct {
+	Added     int `json:"added"`
+	Deleted   int `json:"deleted"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// DiffRows compares two CSV files row by row, matching rows on keyColumns, and
+// calls emit for every added, deleted or changed row in key order. Both files are
+// sorted with bounded memory first, so inputs may be larger than RAM. Columns
+// present on only one side are compared against empty values. Duplicate keys are
+// paired in file order.
+func DiffRows(ctx context.Context, basePath, comparePath string, keyColumns []string, emit func(RowChange) error) (RowDiffSummary, error) {
+	if len(keyColumns) == 0 {
+		return RowDiffSummary{}, fmt.Errorf("invalid key columns: at least one is required")
+	}
+
+	base, err := sortFile(ctx, basePath, keyColumns)
+	if err != nil {
+		return RowDiffSummary{}, fmt.Errorf("base report: %w", err)
+	}
+	defer base.Close()
+	current, err := sortFile(ctx, comparePath, keyColumns)
+	if err != nil {
+		return RowDiffSummary{}, fmt.Errorf("compare report: %w", err)
+	}
+	defer current.Close()
+
+	columns := slices.Clone(base.Header)
+	for _, c := range current.Header {
+		if !slices.Contains(columns, c) {
+			columns = append(columns, c)
+		}
+	}
+
+	var summary RowDiffSummary
+	oldRow, err := base.Next()
+	if err != nil && err != io.EOF {
+		return summary, err
+	}
+	newRow, err := current.Next()
+	if err != nil && err != io.EOF {
+		return summary, err
+	}
+
+	for rows := 1; oldRow != nil || newRow != nil; rows++ {
+		if err := checkContext(ctx, rows); err != nil {
+			return summary, err
+		}
+		var change *RowChange
+		var advanceOld, advanceNew bool
+		switch cmp := compareKeys(base.Key(oldRow), current.Key(newRow), oldRow, newRow); {
+		case cmp < 0:
+			change = &RowChange{Type: RowDeleted, Key: base.Key(oldRow), Row: rowMap(base.Header, oldRow)}
+			summary.Deleted++
+			advanceOld = true
+		case cmp > 0:
+			change = &RowChange{Type: RowAdded, Key: current.Key(newRow), Row: rowMap(current.Header, newRow)}
+			summary.Added++
+			advanceNew = true
+		default:
+			fields := diffFields(columns, rowMap(base.Header, oldRow), rowMap(current.Header, newRow))
+			if len(fields) > 0 {
+				change = &RowChange{Type: RowChanged, Key: base.Key(oldRow), Fields: fields}
+				summary.Changed++
+			} else {
+				summary.Unchanged++
+			}
+			advanceOld, advanceNew = true, true
+		}
+
+		if change != nil {
+			if err := emit(*change); err != nil {
+				return summary, err
+			}
+		}
+		if advanceOld {
+			if oldRow, err = base.Next(); err != nil && err != io.EOF {
+				return summary, err
+			}
+		}
+		if advanceNew {
+			if newRow, err = current.Next(); err != nil && err != io.EOF {
+				return summary, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+func sortFile(ctx context.Context, path string, keyColumns []string) (*csvutil.SortedRows, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report file: %w", err)
+	}
+	defer f.Close()
+	return csvutil.SortCSV(ctx, f, keyColumns, SortChunkRows, "")
+}
+
+// compareKeys orders two row keys, treating an exhausted side (nil row) as
+// greater than any key so the remaining side drains first.
+func compareKeys(a, b []string, aRow, bRow []string) int {
+	switch {
+	case aRow == nil:
+		return 1
+	case bRow == nil:
+		return -1
+	}
+	return slices.Compare(a, b)
+}
+
+func rowMap(header, row []string) map[string]string {
+	m := make(map[string]string, len(header))
+	for i, h := range header {
+		if i < len(row) {
+			m[h] = row[i]
+		} else {
+			m[h] = ""
+		}
+	}
+	return m
+}
+
+func diffFields(columns []string, before, after map[string]string) map[string]FieldChange {
+	var fields map[string]FieldChange
+	for _, c := range columns {
+		if before[c] != after[c] {
+			if fields == nil {
+				fields = make(map[string]FieldChange)
+			}
+			fields[c] = FieldChange{Before: before[c], After: after[c]}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffRows(t *testing.T) {
+	tmpDir := t.TempDir()
+	basePath := filepath.Join(tmpDir, "base.csv")
+	comparePath := filepath.Join(tmpDir, "compare.csv")
+	if err := os.WriteFile(basePath, []byte("invoice_id,status,total\nINV-3,Open,30\nINV-1,Open,10\nINV-2,Paid,20\nINV-4,Open,40\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(comparePath, []byte("status,invoice_id,total\nPaid,INV-1,10\nPaid,INV-2,20\nOpen,INV-5,50\nOpen,INV-4,40\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldChunk := SortChunkRows
+	SortChunkRows = 2
+	defer func() { SortChunkRows = oldChunk }()
+
+	var changes []RowChange
+	summary, err := DiffRows(context.Background(), basePath, comparePath, []string{"invoice_id"}, func(c RowChange) error {
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DiffRows failed: %v", err)
+	}
+
+	if summary != (RowDiffSummary{Added: 1, Deleted: 1, Changed: 1, Unchanged: 2}) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d", len(changes))
+	}
+
+	changed := changes[0]
+	if changed.Type != RowChanged || changed.Key[0] != "INV-1" {
+		t.Errorf("expected INV-1 changed first, got %+v", changed)
+	}
+	if fc := changed.Fields["status"]; fc.Before != "Open" || fc.After != "Paid" || len(changed.Fields) != 1 {
+		t.Errorf("unexpected field changes: %+v", changed.Fields)
+	}
+	if changes[1].Type != RowDeleted || changes[1].Row["total"] != "30" {
+		t.Errorf("expected INV-3 deleted, got %+v", changes[1])
+	}
+	if changes[2].Type != RowAdded || changes[2].Key[0] != "INV-5" {
+		t.Errorf("expected INV-5 added, got %+v", changes[2])
+	}
+
+	t.Run("invalid key column", func(t *testing.T) {
+		_, err := DiffRows(context.Background(), basePath, comparePath, []string{"nope"}, func(RowChange) error { return nil })
+		if err == nil {
+			t.Error("expected error for invalid key column, got nil")
+		}
+	})
+}
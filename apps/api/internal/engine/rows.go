@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// DefaultRowsLimit and MaxRowsLimit bound the page size of BrowseRows.
+const (
+	DefaultRowsLimit = 100
+	MaxRowsLimit     = 1000
+)
+
+// RowsRequest selects a page of raw rows. Pages are addressed either by Offset,
+// the number of matching rows to skip, or by Cursor, the NextCursor of the
+// previous page. Cursors resume where the previous page stopped, so deep pages
+// of filtered rows do not rescan the file. Sort orders by one column,
+// numerically when both values are numbers, descending with Desc.
+type RowsRequest struct {
+	Columns []string
+	Filters []Filter
+	Sort    string
+	Desc    bool
+	Offset  int
+	Limit   int
+	Cursor  string
+}
+
+// RowsResponse is a page of raw rows. NextCursor is empty on the last page.
+type RowsResponse struct {
+	Columns     []string   `json:"columns"`
+	Rows        [][]string `json:"rows"`
+	Offset      int        `json:"offset"`
+	Limit       int        `json:"limit"`
+	NextCursor  string     `json:"nextCursor,omitempty"`
+	RowsScanned int        `json:"rowsScanned"`
+}
+
+// BrowseRows returns a page of the rows of a CSV file. index, which may be nil,
+// lets unsorted pages start reading near their first row instead of at the top
+// of the file.
+func BrowseRows(ctx context.Context, filePath string, index *csvutil.RowIndex, req RowsRequest) (RowsResponse, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultRowsLimit
+	}
+	if limit < 0 || limit > MaxRowsLimit || req.Offset < 0 {
+		return RowsResponse{}, fmt.Errorf("invalid page: limit must be between 1 and %d and offset must not be negative", MaxRowsLimit)
+	}
+
+	// Unsorted cursors hold the data row to resume at, sorted ones the offset.
+	offset, startRow := req.Offset, 0
+	if req.Cursor != "" {
+		pos, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return RowsResponse{}, err
+		}
+		offset = 0
+		if req.Sort != "" {
+			offset = pos
+		} else {
+			startRow = pos
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return RowsResponse{}, fmt.Errorf("failed to open report file: %w", err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	headers, err := csvReader.Read()
+	if err != nil {
+		return RowsResponse{}, fmt.Errorf("failed to read csv headers: %w", err)
+	}
+	headerMap := indexHeaders(headers)
+
+	filters, err := compileFilters(headerMap, req.Filters)
+	if err != nil {
+		return RowsResponse{}, err
+	}
+	columns := req.Columns
+	if len(columns) == 0 {
+		columns = headers
+	}
+	projection := make([]int, len(columns))
+	for i, col := range columns {
+		idx, ok := headerMap[col]
+		if !ok {
+			return RowsResponse{}, fmt.Errorf("invalid column: %s", col)
+		}
+		projection[i] = idx
+	}
+	sortIdx := -1
+	if req.Sort != "" {
+		var ok bool
+		if sortIdx, ok = headerMap[req.Sort]; !ok {
+			return RowsResponse{}, fmt.Errorf("invalid sort column: %s", req.Sort)
+		}
+	}
+
+	// Without filters the n-th matching row is the n-th data row, so an offset
+	// can be served from the index like a cursor.
+	if sortIdx < 0 && len(filters) == 0 && req.Cursor == "" {
+		startRow, offset = offset, 0
+	}
+	rowNum := 0
+	if sortIdx < 0 && startRow > 0 {
+		if indexed, pos, ok := index.Seek(startRow); ok {
+			if _, err := f.Seek(pos, io.SeekStart); err != nil {
+				return RowsResponse{}, fmt.Errorf("failed to seek report file: %w", err)
+			}
+			csvReader = csv.NewReader(f)
+			csvReader.FieldsPerRecord = -1
+			rowNum = indexed
+		}
+	}
+
+	resp := RowsResponse{Columns: columns, Rows: [][]string{}, Offset: req.Offset, Limit: limit}
+	var sorted []sortedRow
+	for ; ; rowNum++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return RowsResponse{}, fmt.Errorf("failed to read csv row: %w", err)
+		}
+		resp.RowsScanned++
+		if err := checkContext(ctx, resp.RowsScanned); err != nil {
+			return RowsResponse{}, err
+		}
+		if rowNum < startRow || !matchFilters(filters, row) {
+			continue
+		}
+
+		if sortIdx >= 0 {
+			key := ""
+			if sortIdx < len(row) {
+				key = row[sortIdx]
+			}
+			sorted = append(sorted, sortedRow{key: key, values: project(row, projection)})
+			// Only the first offset+limit rows can be returned, plus one to
+			// know whether another page follows.
+			if keep := offset + limit + 1; len(sorted) >= 2*keep {
+				sorted = sortRows(sorted, req.Desc)[:keep]
+			}
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(resp.Rows) == limit {
+			resp.NextCursor = encodeCursor(rowNum)
+			break
+		}
+		resp.Rows = append(resp.Rows, project(row, projection))
+	}
+
+	if sortIdx >= 0 {
+		sorted = sortRows(sorted, req.Desc)
+		for i := offset; i < len(sorted) && i < offset+limit; i++ {
+			resp.Rows = append(resp.Rows, sorted[i].values)
+		}
+		if len(sorted) > offset+limit {
+			resp.NextCursor = encodeCursor(offset + limit)
+		}
+	}
+	return resp, nil
+}
+
+type sortedRow struct {
+	key    string
+	values []string
+}
+
+// sortRows orders rows by key, keeping file order among equal keys.
+func sortRows(rows []sortedRow, desc bool) []sortedRow {
+	slices.SortStableFunc(rows, func(a, b sortedRow) int {
+		if desc {
+			return compareValues(b.key, a.key)
+		}
+		return compareValues(a.key, b.key)
+	})
+	return rows
+}
+
+func project(row []string, projection []int) []string {
+	values := make([]string, len(projection))
+	for i, idx := range projection {
+		if idx < len(row) {
+			values[i] = row[idx]
+		}
+	}
+	return values
+}
+
+func encodeCursor(pos int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("p" + strconv.Itoa(pos)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(data), "p") {
+		if pos, err := strconv.Atoi(string(data[1:])); err == nil && pos >= 0 {
+			return pos, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor: %s", cursor)
+}
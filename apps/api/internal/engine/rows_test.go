@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+func TestBrowseRows(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("id,region,amount\n")
+	for i := 0; i < 10; i++ {
+		region := "EU"
+		if i%2 == 1 {
+			region = "US"
+		}
+		sb.WriteString(strings.Join([]string{string(rune('0' + i)), region, string(rune('0' + (i*7)%10))}, ",") + "\n")
+	}
+	csvPath := filepath.Join(t.TempDir(), "rows.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+	f, _ := os.Open(csvPath)
+	_, index, err := csvutil.IndexRows(context.Background(), f, 3)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(resp RowsResponse) string {
+		var out []string
+		for _, row := range resp.Rows {
+			out = append(out, row[0])
+		}
+		return strings.Join(out, ",")
+	}
+
+	t.Run("offset uses the index", func(t *testing.T) {
+		resp, err := BrowseRows(context.Background(), csvPath, &index, RowsRequest{Offset: 7, Limit: 2, Columns: []string{"id"}})
+		if err != nil {
+			t.Fatalf("BrowseRows failed: %v", err)
+		}
+		if ids(resp) != "7,8" || resp.RowsScanned != 4 || resp.NextCursor == "" {
+			t.Errorf("unexpected page: %+v", resp)
+		}
+		if len(resp.Columns) != 1 {
+			t.Errorf("expected projected columns, got %v", resp.Columns)
+		}
+
+		next, err := BrowseRows(context.Background(), csvPath, &index, RowsRequest{Cursor: resp.NextCursor, Limit: 2})
+		if err != nil {
+			t.Fatalf("BrowseRows failed: %v", err)
+		}
+		if ids(next) != "9" || next.NextCursor != "" {
+			t.Errorf("unexpected last page: %+v", next)
+		}
+	})
+
+	t.Run("filtered pages follow cursors", func(t *testing.T) {
+		req := RowsRequest{Filters: []Filter{{Field: "region", Op: "eq", Value: "US"}}, Limit: 2}
+		var pages []string
+		for {
+			resp, err := BrowseRows(context.Background(), csvPath, &index, req)
+			if err != nil {
+				t.Fatalf("BrowseRows failed: %v", err)
+			}
+			pages = append(pages, ids(resp))
+			if resp.NextCursor == "" {
+				break
+			}
+			req.Cursor = resp.NextCursor
+		}
+		if got := strings.Join(pages, "|"); got != "1,3|5,7|9" {
+			t.Errorf("unexpected pages: %s", got)
+		}
+	})
+
+	t.Run("sorted", func(t *testing.T) {
+		resp, err := BrowseRows(context.Background(), csvPath, nil, RowsRequest{Sort: "amount", Desc: true, Limit: 3})
+		if err != nil {
+			t.Fatalf("BrowseRows failed: %v", err)
+		}
+		// amounts are (id*7)%10: 9→3, 8→6, 7→9, ...
+		if ids(resp) != "7,4,1" || resp.NextCursor == "" {
+			t.Errorf("unexpected sorted page: %+v", resp)
+		}
+		next, err := BrowseRows(context.Background(), csvPath, nil, RowsRequest{Sort: "amount", Desc: true, Limit: 3, Cursor: resp.NextCursor})
+		if err != nil {
+			t.Fatalf("BrowseRows failed: %v", err)
+		}
+		if ids(next) != "8,5,2" {
+			t.Errorf("unexpected second sorted page: %+v", next)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, req := range []RowsRequest{
+			{Limit: MaxRowsLimit + 1},
+			{Sort: "missing"},
+			{Columns: []string{"missing"}},
+			{Cursor: "not-a-cursor"},
+		} {
+			if _, err := BrowseRows(context.Background(), csvPath, nil, req); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("%+v: expected invalid error, got %v", req, err)
+			}
+		}
+	})
+}
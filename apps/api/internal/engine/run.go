@@ -1,26 +1,45 @@
 package engine
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
-	"io"
 	"log"
+	"math/big"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"erp-export-analytics/api/internal/csvutil"
 )
 
 // RunReport processes a CSV file based on the provided request parameters,
-// performing filtering, grouping, and metric aggregation.
-func RunReport(filePath string, req ReportRequest) (ReportResponse, error) {
+// performing filtering, grouping, and metric aggregation. Files with a current
+// column cache (see BuildColumnCache) are read from it instead of the CSV, and
+// other files larger than ScanChunkBytes are scanned in parallel with the same
+// result as a sequential scan. The scan stops with ErrTimeout or ErrCancelled
+// once ctx is done.
+func RunReport(ctx context.Context, filePath string, req ReportRequest) (ReportResponse, error) {
+	return RunReportWithProgress(ctx, filePath, req, nil)
+}
+
+// RunReportWithProgress is RunReport with progress reporting. When progress is
+// not nil it is called every ProgressInterval rows, or after every chunk of a
+// parallel scan, and once the scan completes.
+func RunReportWithProgress(ctx context.Context, filePath string, req ReportRequest, progress func(Progress)) (ReportResponse, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return ReportResponse{}, fmt.Errorf("failed to open report file: %w", err)
 	}
 	defer f.Close()
 
-	csvReader := csv.NewReader(f)
+	var totalBytes int64
+	if info, err := f.Stat(); err == nil {
+		totalBytes = info.Size()
+	}
+	counter := &countingReader{r: f}
+	csvReader := csv.NewReader(counter)
 	csvReader.FieldsPerRecord = -1
 
 	headers, err := csvReader.Read()
@@ -28,178 +47,370 @@ func RunReport(filePath string, req ReportRequest) (ReportResponse, error) {
 		return ReportResponse{}, fmt.Errorf("failed to read csv headers: %w", err)
 	}
 
-	headerMap := make(map[string]int)
-	for i, h := range headers {
-		headerMap[h] = i
+	headers, joins, err := planJoins(ctx, headers, req.Joins)
+	if err != nil {
+		return ReportResponse{}, err
 	}
+	headerMap := indexHeaders(headers)
 
 	// Simple validation and setup
-	var groupByIndices []int
-	for _, gb := range req.GroupBy {
-		idx, ok := headerMap[gb]
-		if !ok {
-			return ReportResponse{}, fmt.Errorf("invalid groupBy column: %s", gb)
-		}
-		groupByIndices = append(groupByIndices, idx)
+	groupByIndices, err := groupByColumns(headerMap, req.GroupBy)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	bucket, err := compileTimeBucket(req.TimeBucket, req.GroupBy, headerMap)
+	if err != nil {
+		return ReportResponse{}, err
 	}
 
 	// Metrics setup
-	type metricInfo struct {
-		op    string
-		field string
-		idx   int
-	}
-	var metrics []metricInfo
-	for _, m := range req.Metrics {
-		idx := -1
-		if m.Field != "" {
-			var ok bool
-			idx, ok = headerMap[m.Field]
-			if !ok {
-				return ReportResponse{}, fmt.Errorf("invalid metric field: %s", m.Field)
-			}
-		}
-		metrics = append(metrics, metricInfo{op: m.Op, field: m.Field, idx: idx})
+	metrics, err := compileMetrics(headerMap, req.Metrics)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	sampleRate, err := compileApproximation(req, metrics)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	windows, err := compileWindows(req.GroupBy, metrics, req.Windows)
+	if err != nil {
+		return ReportResponse{}, err
 	}
 
 	// Filter setup
-	type filterInfo struct {
-		idx   int
-		op    string
-		value string
-	}
-	var filters []filterInfo
-	for _, f := range req.Filters {
-		idx, ok := headerMap[f.Field]
-		if !ok {
-			return ReportResponse{}, fmt.Errorf("invalid filter field: %s", f.Field)
+	filters, err := compileFilters(headerMap, req.Filters)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+
+	var fx *fxConverter
+	converts := slices.ContainsFunc(metrics, metricInfo.amounts)
+	if req.Currency != nil && converts {
+		if fx, err = newFXConverter(ctx, req.Currency, headerMap); err != nil {
+			return ReportResponse{}, err
+		}
+	}
+
+	// Prepare response
+	respColumns := []string{}
+	respColumns = append(respColumns, req.GroupBy...)
+	for _, m := range metrics {
+		respColumns = append(respColumns, m.name())
+	}
+	for _, w := range windows {
+		respColumns = append(respColumns, w.name)
+	}
+	sortIdx := -1
+	if req.Sort != "" {
+		if sortIdx = slices.Index(respColumns, req.Sort); sortIdx < 0 {
+			return ReportResponse{}, fmt.Errorf("invalid sort column: %s", req.Sort)
 		}
-		filters = append(filters, filterInfo{idx: idx, op: f.Op, value: f.Value})
 	}
 
 	// Aggregation
-	type aggState struct {
-		sum   float64
-		count int64
+	agg := &aggregation{
+		grouped: len(groupByIndices) > 0,
+		bucket:  bucket,
+		metrics: metrics,
+		windows: windows,
+		results: make(map[string][]aggState),
 	}
-	results := make(map[string][]aggState)
-	groupOrder := []string{}
-	rowsScanned := 0
+	plan := &scanPlan{sample: sampleThreshold(sampleRate), joins: joins, filters: filters, groupBy: groupByIndices, metrics: metrics}
 
-	for {
-		row, err := csvReader.Read()
-		if err == io.EOF {
-			break
+	var lastPartial time.Time
+	report := func(rowsScanned int, bytesRead int64) {
+		p := Progress{RowsScanned: rowsScanned, BytesRead: bytesRead, TotalBytes: totalBytes, Groups: len(agg.groupOrder)}
+		if sortIdx >= 0 && (lastPartial.IsZero() || time.Since(lastPartial) >= PartialInterval) {
+			lastPartial = time.Now()
+			limit := req.Limit
+			if limit <= 0 {
+				limit = PartialRows
+			}
+			// A report whose gaps cannot be filled fails at its end; until then it
+			// has no partial rows.
+			if rows, err := agg.rows(); err == nil {
+				p.Partial = &ReportResponse{
+					Columns:     respColumns,
+					Rows:        topRows(rows, sortIdx, req.Desc, limit),
+					RowsScanned: rowsScanned,
+				}
+			}
 		}
+		progress(p)
+	}
+
+	// Uploads are read from their column cache while it is current. Otherwise
+	// large files are split into chunks of whole records and scanned in parallel.
+	var rowsScanned int
+	var records recordReader = csvReader
+	bytesRead := func(int) int64 { return counter.n }
+	var chunks []csvutil.Chunk
+	if table := loadColumnCache(ctx, filePath); table != nil {
+		records = newColumnCursor(table)
+		bytesRead = func(rows int) int64 { return totalBytes * int64(rows) / int64(max(table.Rows, 1)) }
+	} else if ScanWorkers > 1 {
+		chunks, err = csvutil.SplitChunks(ctx, f, csvReader.InputOffset(), totalBytes, ScanChunkBytes, ScanWorkers)
 		if err != nil {
-			log.Printf("error reading csv row: %v", err)
-			break
+			return ReportResponse{}, fmt.Errorf("failed to split report file: %w", err)
 		}
-		rowsScanned++
-
-		// Apply filters
-		match := true
-		for _, f := range filters {
-			if f.idx >= len(row) {
-				match = false
-				break
-			}
-			val := row[f.idx]
-			if f.op == "eq" {
-				if val != f.value {
-					match = false
-					break
-				}
-			} else if f.op == "contains" {
-				if !strings.Contains(strings.ToLower(val), strings.ToLower(f.value)) {
-					match = false
-					break
-				}
+	}
+	if len(chunks) > 1 {
+		var onChunk func(int, int64)
+		if progress != nil {
+			onChunk = report
+		}
+		if rowsScanned, err = plan.scanParallel(ctx, f, chunks, agg, fx, onChunk); err != nil {
+			return ReportResponse{}, err
+		}
+	} else {
+		onRow := func(rows int) {
+			if progress != nil && rows%ProgressInterval == 0 {
+				report(rows, bytesRead(rows))
 			}
 		}
-		if !match {
-			continue
+		var parseErr error
+		if rowsScanned, parseErr, err = plan.scanRows(ctx, records, agg, fx, onRow); err != nil {
+			return ReportResponse{}, err
 		}
+		if parseErr != nil {
+			log.Printf("error reading csv row: %v", parseErr)
+		}
+		if progress != nil {
+			report(rowsScanned, bytesRead(rowsScanned))
+		}
+	}
 
-		// Determine group
-		var groupValues []string
-		for _, idx := range groupByIndices {
-			if idx < len(row) {
-				groupValues = append(groupValues, row[idx])
-			} else {
-				groupValues = append(groupValues, "")
-			}
+	respRows, err := agg.rows()
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	if sortIdx >= 0 {
+		respRows = topRows(respRows, sortIdx, req.Desc, req.Limit)
+	} else if req.Limit > 0 && len(respRows) > req.Limit {
+		respRows = respRows[:req.Limit]
+	}
+
+	resp := ReportResponse{
+		Columns:     respColumns,
+		Rows:        respRows,
+		RowsScanned: rowsScanned,
+	}
+	if fx != nil {
+		resp.Currency = fx.target
+		resp.MissingRates = fx.missingRates()
+	}
+	if req.Approximate {
+		resp.Approximation = agg.approximation(sampleRate)
+	}
+	return resp, nil
+}
+
+// aggregation holds the metric states of the groups found so far, in the order
+// they were first seen. bytes estimates the memory they take, and sampled counts
+// the records aggregated.
+type aggregation struct {
+	grouped    bool
+	bucket     *bucketInfo
+	metrics    []metricInfo
+	windows    []windowInfo
+	results    map[string][]aggState
+	groupOrder []string
+	bytes      int64
+	sampled    int
+}
+
+// group returns the metric states of a group, adding the group when it is new.
+// It fails with ErrTooManyGroups when the new group exceeds GroupMemoryBudget.
+func (a *aggregation) group(groupValues []string) ([]aggState, error) {
+	groupKey := strings.Join(groupValues, "\x1f")
+	states, ok := a.results[groupKey]
+	if !ok {
+		states = make([]aggState, len(a.metrics))
+		a.results[groupKey] = states
+		a.groupOrder = append(a.groupOrder, groupKey)
+		a.bytes += a.groupBytes(groupKey)
+		if err := a.checkBudget(); err != nil {
+			return nil, err
 		}
-		groupKey := strings.Join(groupValues, "\x1f")
-
-		if _, ok := results[groupKey]; !ok {
-			results[groupKey] = make([]aggState, len(metrics))
-			groupOrder = append(groupOrder, groupKey)
-		}
-
-		// Update metrics
-		for i, m := range metrics {
-			switch m.op {
-			case "count":
-				results[groupKey][i].count++
-			case "sum", "avg":
-				if m.idx < len(row) {
-					valStr := row[m.idx]
-					if val, ok := csvutil.InferNumeric(valStr); ok {
-						results[groupKey][i].sum += val
-						results[groupKey][i].count++
-					}
-				}
+	}
+	return states, nil
+}
+
+// fork returns an empty aggregation of the same report, for one chunk of a
+// parallel scan.
+func (a *aggregation) fork() *aggregation {
+	part := *a
+	part.bucket = a.bucket.fork()
+	part.results = make(map[string][]aggState)
+	part.groupOrder = nil
+	part.bytes = 0
+	part.sampled = 0
+	return &part
+}
+
+// merge folds a chunk's aggregation into a. Merging chunks in file order keeps
+// the groups in the order a sequential scan finds them. Like group, it fails
+// with ErrTooManyGroups once the merged groups exceed GroupMemoryBudget.
+func (a *aggregation) merge(part *aggregation) error {
+	a.bucket.merge(part.bucket)
+	a.sampled += part.sampled
+	for _, groupKey := range part.groupOrder {
+		states, ok := a.results[groupKey]
+		if !ok {
+			states = part.results[groupKey]
+			a.results[groupKey] = states
+			a.groupOrder = append(a.groupOrder, groupKey)
+			a.bytes += a.groupBytes(groupKey)
+			for i := range states {
+				a.bytes += states[i].size
 			}
+			continue
+		}
+		for i := range states {
+			size := states[i].size
+			states[i].merge(&part.results[groupKey][i])
+			a.bytes += states[i].size - size
 		}
 	}
+	return a.checkBudget()
+}
 
-	// Prepare response
-	respColumns := []string{}
-	respColumns = append(respColumns, req.GroupBy...)
-	for _, m := range req.Metrics {
-		colName := m.Op
-		if m.Field != "" {
-			colName += "(" + m.Field + ")"
+// groupBytes estimates the memory of one group: its key, held by the results
+// map and groupOrder, and its metric states.
+func (a *aggregation) groupBytes(groupKey string) int64 {
+	return groupOverheadBytes + int64(len(groupKey)) + int64(len(a.metrics))*stateBytes
+}
+
+func (a *aggregation) checkBudget() error {
+	if GroupMemoryBudget > 0 && a.bytes > GroupMemoryBudget {
+		hint := "group by fewer or coarser columns or add filters"
+		if slices.ContainsFunc(a.metrics, metricInfo.keepsValues) {
+			hint = "group by fewer or coarser columns, add filters or set approximate"
 		}
-		respColumns = append(respColumns, colName)
+		return fmt.Errorf("%w: found %d distinct groups, more than the aggregation memory budget of %.1f MB allows; %s",
+			ErrTooManyGroups, len(a.groupOrder), float64(GroupMemoryBudget)/(1<<20), hint)
 	}
+	return nil
+}
 
-	respRows := [][]string{}
-	for _, gk := range groupOrder {
-		states := results[gk]
-		row := []string{}
-		if len(groupByIndices) > 0 {
-			groupValues := strings.Split(gk, "\x1f")
-			row = append(row, groupValues...)
-		}
-
-		for i, st := range states {
-			switch req.Metrics[i].Op {
-			case "count":
-				row = append(row, fmt.Sprintf("%d", st.count))
-			case "sum":
-				row = append(row, fmt.Sprintf("%.2f", st.sum))
-			case "avg":
-				if st.count > 0 {
-					row = append(row, fmt.Sprintf("%.2f", st.sum/float64(st.count)))
-				} else {
-					row = append(row, "0.00")
-				}
+// rows formats every group as a result row, filling missing periods when
+// requested. Window metrics see every group, so callers apply any limit after.
+// Filling fails with ErrTooManyGroups when the filled groups would exceed
+// GroupMemoryBudget.
+func (a *aggregation) rows() ([][]string, error) {
+	keys := make([][]string, len(a.groupOrder))
+	for g, gk := range a.groupOrder {
+		keys[g] = strings.Split(gk, "\x1f")
+	}
+	bucket := a.bucket
+	if bucket != nil && bucket.fill {
+		maxGroups := 0
+		if GroupMemoryBudget > 0 {
+			maxGroups = int(GroupMemoryBudget / a.groupBytes(""))
+		}
+		var err error
+		if keys, err = bucket.fillGaps(keys, maxGroups); err != nil {
+			return nil, err
+		}
+	}
+	cells := make([][]string, len(keys))
+	values := make([][]*big.Rat, len(keys))
+	for g, key := range keys {
+		states, ok := a.results[strings.Join(key, "\x1f")]
+		for i, m := range a.metrics {
+			var cell string
+			var value *big.Rat
+			switch {
+			case ok:
+				cell, value = m.format(&states[i]), m.value(&states[i])
+			case m.fill == FillPrevious && g > 0 && bucket.series(keys[g-1]) == bucket.series(key):
+				cell, value = cells[g-1][i], values[g-1][i]
+			case m.fill == FillNull || m.fill == FillPrevious:
+				// Window metrics treat empty periods as zero.
+				cell, value = "", new(big.Rat)
 			default:
-				row = append(row, fmt.Sprintf("%.2f", st.sum))
+				cell, value = m.format(&aggState{}), new(big.Rat)
 			}
+			cells[g] = append(cells[g], cell)
+			values[g] = append(values[g], value)
 		}
+	}
 
+	var windowValues [][]string
+	for _, w := range a.windows {
+		windowValues = append(windowValues, w.eval(keys, values))
+	}
+
+	respRows := [][]string{}
+	for g, key := range keys {
+		row := []string{}
+		if a.grouped {
+			row = append(row, key...)
+		}
+		row = append(row, cells[g]...)
+		for _, col := range windowValues {
+			row = append(row, col[g])
+		}
 		respRows = append(respRows, row)
-		if req.Limit > 0 && len(respRows) >= req.Limit {
-			break
+	}
+	return respRows, nil
+}
+
+// topRows sorts rows by column col, keeping group order among equal values, and
+// returns the first limit rows, or all of them when limit is zero.
+func topRows(rows [][]string, col int, desc bool, limit int) [][]string {
+	slices.SortStableFunc(rows, func(a, b []string) int {
+		if desc {
+			return compareValues(b[col], a[col])
 		}
+		return compareValues(a[col], b[col])
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
 	}
+	return rows
+}
 
-	return ReportResponse{
-		Columns:     respColumns,
-		Rows:        respRows,
-		RowsScanned: rowsScanned,
-	}, nil
+func groupByColumns(headerMap map[string]int, groupBy []string) ([]int, error) {
+	var groupByIndices []int
+	for _, gb := range groupBy {
+		idx, ok := headerMap[gb]
+		if !ok {
+			return nil, fmt.Errorf("invalid groupBy column: %s", gb)
+		}
+		groupByIndices = append(groupByIndices, idx)
+	}
+	return groupByIndices, nil
+}
+
+// rowGroup returns the group-by values of a row, with the time bucket column
+// replaced by its period label, using the parsed date from typed when it has
+// one. It reports false when the row falls outside the bucket range.
+func rowGroup(row []string, groupByIndices []int, bucket *bucketInfo, typed typedValues) ([]string, bool) {
+	var groupValues []string
+	for _, idx := range groupByIndices {
+		if idx < len(row) {
+			groupValues = append(groupValues, row[idx])
+		} else {
+			groupValues = append(groupValues, "")
+		}
+	}
+	if bucket != nil {
+		var label string
+		ok, known := false, false
+		if typed != nil {
+			var t time.Time
+			if t, ok, known = typed.date(bucket.idx); ok {
+				label, ok = bucket.labelDate(t)
+			}
+		}
+		if !known {
+			label, ok = bucket.label(groupValues[bucket.pos])
+		}
+		if !ok {
+			return nil, false
+		}
+		groupValues[bucket.pos] = label
+	}
+	return groupValues, true
 }
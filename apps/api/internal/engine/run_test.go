@@ -1,9 +1,13 @@
 package engine
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunReport(t *testing.T) {
@@ -25,12 +29,9 @@ func TestRunReport(t *testing.T) {
 
 	t.Run("count formatting is integer", func(t *testing.T) {
 		req := ReportRequest{
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{{Op: "count"}},
+			Metrics: []Metric{{Op: "count"}},
 		}
-		resp, err := RunReport(csvPath, req)
+		resp, err := RunReport(context.Background(), csvPath, req)
 		if err != nil {
 			t.Fatalf("RunReport failed: %v", err)
 		}
@@ -43,12 +44,9 @@ func TestRunReport(t *testing.T) {
 	t.Run("groupBy + count", func(t *testing.T) {
 		req := ReportRequest{
 			GroupBy: []string{"category"},
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{{Op: "count"}},
+			Metrics: []Metric{{Op: "count"}},
 		}
-		resp, err := RunReport(csvPath, req)
+		resp, err := RunReport(context.Background(), csvPath, req)
 		if err != nil {
 			t.Fatalf("RunReport failed: %v", err)
 		}
@@ -71,12 +69,9 @@ func TestRunReport(t *testing.T) {
 	t.Run("groupBy + sum (numeric parsing)", func(t *testing.T) {
 		req := ReportRequest{
 			GroupBy: []string{"category"},
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{{Op: "sum", Field: "amount"}},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
 		}
-		resp, err := RunReport(csvPath, req)
+		resp, err := RunReport(context.Background(), csvPath, req)
 		if err != nil {
 			t.Fatalf("RunReport failed: %v", err)
 		}
@@ -97,17 +92,10 @@ func TestRunReport(t *testing.T) {
 
 	t.Run("filter eq", func(t *testing.T) {
 		req := ReportRequest{
-			Filters: []struct {
-				Field string `json:"field"`
-				Op    string `json:"op"`
-				Value string `json:"value"`
-			}{{Field: "category", Op: "eq", Value: "Books"}},
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{{Op: "count"}},
-		}
-		resp, err := RunReport(csvPath, req)
+			Filters: []Filter{{Field: "category", Op: "eq", Value: "Books"}},
+			Metrics: []Metric{{Op: "count"}},
+		}
+		resp, err := RunReport(context.Background(), csvPath, req)
 		if err != nil {
 			t.Fatalf("RunReport failed: %v", err)
 		}
@@ -118,17 +106,10 @@ func TestRunReport(t *testing.T) {
 
 	t.Run("filter contains (case-insensitive)", func(t *testing.T) {
 		req := ReportRequest{
-			Filters: []struct {
-				Field string `json:"field"`
-				Op    string `json:"op"`
-				Value string `json:"value"`
-			}{{Field: "name", Op: "contains", Value: "item"}}, // lowercase search
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{{Op: "count"}},
-		}
-		resp, err := RunReport(csvPath, req)
+			Filters: []Filter{{Field: "name", Op: "contains", Value: "item"}}, // lowercase search
+			Metrics: []Metric{{Op: "count"}},
+		}
+		resp, err := RunReport(context.Background(), csvPath, req)
 		if err != nil {
 			t.Fatalf("RunReport failed: %v", err)
 		}
@@ -137,11 +118,33 @@ func TestRunReport(t *testing.T) {
 		}
 	})
 
+	t.Run("sort before limit", func(t *testing.T) {
+		req := ReportRequest{
+			GroupBy: []string{"category"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
+			Sort:    "sum(amount)",
+			Limit:   2,
+		}
+		resp, err := RunReport(context.Background(), csvPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		// Expected: Clothing(0.00), Books(50.00); Electronics(160.50) is cut by the limit
+		if len(resp.Rows) != 2 || resp.Rows[0][0] != "Clothing" || resp.Rows[1][0] != "Books" {
+			t.Errorf("unexpected sorted rows: %v", resp.Rows)
+		}
+
+		req.Sort = "missing"
+		if _, err := RunReport(context.Background(), csvPath, req); err == nil || !strings.Contains(err.Error(), "invalid sort column") {
+			t.Errorf("expected invalid sort column error, got %v", err)
+		}
+	})
+
 	t.Run("invalid groupBy column returns error", func(t *testing.T) {
 		req := ReportRequest{
 			GroupBy: []string{"invalid_col"},
 		}
-		_, err := RunReport(csvPath, req)
+		_, err := RunReport(context.Background(), csvPath, req)
 		if err == nil {
 			t.Error("expected error for invalid groupBy column, got nil")
 		}
@@ -149,12 +152,9 @@ func TestRunReport(t *testing.T) {
 
 	t.Run("invalid metric column returns error", func(t *testing.T) {
 		req := ReportRequest{
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{{Op: "sum", Field: "invalid_col"}},
+			Metrics: []Metric{{Op: "sum", Field: "invalid_col"}},
 		}
-		_, err := RunReport(csvPath, req)
+		_, err := RunReport(context.Background(), csvPath, req)
 		if err == nil {
 			t.Error("expected error for invalid metric column, got nil")
 		}
@@ -162,13 +162,9 @@ func TestRunReport(t *testing.T) {
 
 	t.Run("invalid filter column returns error", func(t *testing.T) {
 		req := ReportRequest{
-			Filters: []struct {
-				Field string `json:"field"`
-				Op    string `json:"op"`
-				Value string `json:"value"`
-			}{{Field: "invalid_col", Op: "eq", Value: "val"}},
+			Filters: []Filter{{Field: "invalid_col", Op: "eq", Value: "val"}},
 		}
-		_, err := RunReport(csvPath, req)
+		_, err := RunReport(context.Background(), csvPath, req)
 		if err == nil {
 			t.Error("expected error for invalid filter column, got nil")
 		}
@@ -177,15 +173,12 @@ func TestRunReport(t *testing.T) {
 	t.Run("multiple groupBy + avg", func(t *testing.T) {
 		req := ReportRequest{
 			GroupBy: []string{"category", "name"},
-			Metrics: []struct {
-				Op    string `json:"op"`
-				Field string `json:"field,omitempty"`
-			}{
+			Metrics: []Metric{
 				{Op: "avg", Field: "amount"},
 				{Op: "count"},
 			},
 		}
-		resp, err := RunReport(csvPath, req)
+		resp, err := RunReport(context.Background(), csvPath, req)
 		if err != nil {
 			t.Fatalf("RunReport failed: %v", err)
 		}
@@ -212,3 +205,92 @@ func TestRunReport(t *testing.T) {
 		}
 	})
 }
+
+func TestRunReportWithProgress(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("id,amount\n")
+	for i := 0; i < 2*ProgressInterval+5; i++ {
+		sb.WriteString("1,2\n")
+	}
+	csvPath := filepath.Join(t.TempDir(), "large.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+	req := ReportRequest{Metrics: []Metric{{Op: "sum", Field: "amount"}}}
+
+	t.Run("reports progress", func(t *testing.T) {
+		var updates []Progress
+		resp, err := RunReportWithProgress(context.Background(), csvPath, req, func(p Progress) {
+			updates = append(updates, p)
+		})
+		if err != nil {
+			t.Fatalf("RunReportWithProgress failed: %v", err)
+		}
+		if resp.Rows[0][0] != "40010.00" {
+			t.Errorf("unexpected result: %v", resp.Rows)
+		}
+		last := updates[len(updates)-1]
+		if len(updates) != 3 || last.RowsScanned != resp.RowsScanned || last.Percent() != 100 {
+			t.Errorf("unexpected progress updates: %+v", updates)
+		}
+	})
+
+	t.Run("reports groups and partial top rows", func(t *testing.T) {
+		sorted := ReportRequest{
+			GroupBy: []string{"id"},
+			Metrics: []Metric{{Op: "count"}},
+			Sort:    "count",
+			Desc:    true,
+		}
+		var updates []Progress
+		if _, err := RunReportWithProgress(context.Background(), csvPath, sorted, func(p Progress) {
+			updates = append(updates, p)
+		}); err != nil {
+			t.Fatalf("RunReportWithProgress failed: %v", err)
+		}
+		first := updates[0]
+		if first.Groups != 1 || first.Partial == nil || first.Partial.RowsScanned != ProgressInterval {
+			t.Fatalf("unexpected first update: %+v", first)
+		}
+		if got := first.Partial.Rows; len(got) != 1 || got[0][1] != "10000" {
+			t.Errorf("unexpected partial rows: %v", got)
+		}
+	})
+
+	t.Run("limits partial rows to one per interval", func(t *testing.T) {
+		defer func(interval time.Duration) { PartialInterval = interval }(PartialInterval)
+		PartialInterval = time.Hour
+
+		var updates []Progress
+		sorted := ReportRequest{GroupBy: []string{"id"}, Metrics: []Metric{{Op: "count"}}, Sort: "count"}
+		if _, err := RunReportWithProgress(context.Background(), csvPath, sorted, func(p Progress) {
+			updates = append(updates, p)
+		}); err != nil {
+			t.Fatalf("RunReportWithProgress failed: %v", err)
+		}
+		if len(updates) < 2 || updates[0].Partial == nil {
+			t.Fatalf("expected a partial result with the first of several updates, got %+v", updates)
+		}
+		for _, p := range updates[1:] {
+			if p.Partial != nil {
+				t.Errorf("expected no partial result within the interval, got %+v", p)
+			}
+		}
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := RunReportWithProgress(ctx, csvPath, req, nil); !errors.Is(err, ErrCancelled) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected ErrCancelled, got %v", err)
+		}
+	})
+
+	t.Run("stops when the time budget runs out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		if _, err := RunReport(ctx, csvPath, req); !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected ErrTimeout, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// ScanWorkers is the number of goroutines that aggregate a large report in
+// parallel.
+var ScanWorkers = runtime.GOMAXPROCS(0)
+
+// GroupMemoryBudget bounds the estimated memory of the groups of one report.
+// Reports with more groups fail with ErrTooManyGroups; zero means no bound. The
+// partial groups of a parallel scan are bounded by ScanChunkBytes instead.
+var GroupMemoryBudget int64 = 256 << 20
+
+// Memory estimates of a group: the overhead of its key in the results map and
+// group order, the size of one metric state, and the size of one value of an
+// exact count_distinct (besides its text) or an exact median or percentile.
+const (
+	groupOverheadBytes = 96
+	stateBytes         = 80
+	distinctBytes      = 48
+	valueBytes         = 64
+)
+
+// ScanChunkBytes is the size of the byte ranges a large report is split into.
+// Files with no more than one chunk of rows are scanned sequentially.
+var ScanChunkBytes int64 = 8 << 20
+
+// recordReader is a source of CSV records: a csv.Reader, a chunkReader or a
+// columnCursor. InputOffset is the byte offset in the file of the end of the
+// record read last.
+type recordReader interface {
+	Read() ([]string, error)
+	InputOffset() int64
+}
+
+// chunkReader reads the records of one chunk of a file, with offsets in the
+// whole file.
+type chunkReader struct {
+	*csv.Reader
+	start int64
+}
+
+func (r chunkReader) InputOffset() int64 {
+	return r.start + r.Reader.InputOffset()
+}
+
+// typedValues is implemented by record readers that hold parsed values of the
+// current record, so they need not be parsed again. known is false for columns
+// without typed values, whose text must be parsed instead.
+type typedValues interface {
+	decimal(col int, dst *big.Rat) (ok, known bool)
+	date(col int) (t time.Time, ok, known bool)
+}
+
+// scanPlan is the compiled row pipeline of a report: sampling, joins, filters,
+// grouping and metrics.
+type scanPlan struct {
+	// sample is the hash threshold of the rows in a sample, or zero when every
+	// row is aggregated.
+	sample  uint64
+	joins   []joinPlan
+	filters []filterInfo
+	groupBy []int
+	metrics []metricInfo
+}
+
+// scanRows aggregates the records of r, or those in the sample, into agg, converting amounts with fx
+// when it is not nil, and calls onRow after every record. It stops at the first
+// malformed record and returns its parse error apart from err, which reports
+// cancellation, since the rows read up to there still count.
+func (p *scanPlan) scanRows(ctx context.Context, r recordReader, agg *aggregation, fx *fxConverter, onRow func(rows int)) (rows int, parseErr, err error) {
+	typed, _ := r.(typedValues)
+	var val big.Rat
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return rows, nil, nil
+		}
+		if err != nil {
+			return rows, err, nil
+		}
+		rows++
+		if err := checkContext(ctx, rows); err != nil {
+			return rows, nil, err
+		}
+
+		if p.sample == 0 || sampled(r.InputOffset(), p.sample) {
+			agg.sampled++
+			if err := p.aggregate(row, agg, fx, typed, &val); err != nil {
+				return rows, nil, err
+			}
+		}
+		if onRow != nil {
+			onRow(rows)
+		}
+	}
+}
+
+// aggregate folds one record of the report file, joined with its matches, into
+// agg.
+func (p *scanPlan) aggregate(row []string, agg *aggregation, fx *fxConverter, typed typedValues, val *big.Rat) error {
+	// missed lists the rates this record lacked, which are counted once however
+	// many rows it joins to.
+	var missed [][2]string
+	for _, row := range applyJoins(p.joins, row) {
+		// Apply filters
+		if !matchFilters(p.filters, row) {
+			continue
+		}
+
+		// Determine group
+		groupValues, ok := rowGroup(row, p.groupBy, agg.bucket, typed)
+		if !ok {
+			continue
+		}
+		states, err := agg.group(groupValues)
+		if err != nil {
+			return err
+		}
+
+		// Convert amounts to the reporting currency
+		var rate *big.Rat
+		hasRate := true
+		if fx != nil {
+			var key [2]string
+			rate, key, hasRate = fx.rowRate(row)
+			if !hasRate && !slices.Contains(missed, key) {
+				missed = append(missed, key)
+				fx.recordMissing(key)
+			}
+		}
+
+		// Update metrics, accounting for the values they keep
+		var grown int64
+		for i, m := range p.metrics {
+			size := states[i].size
+			m.add(&states[i], row, typed, rate, hasRate, val)
+			grown += states[i].size - size
+		}
+		if grown != 0 {
+			agg.bytes += grown
+			if err := agg.checkBudget(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// chunkResult is the partial aggregation of one chunk.
+type chunkResult struct {
+	agg      *aggregation
+	fx       *fxConverter
+	rows     int
+	parseErr error
+	err      error
+}
+
+// scanParallel aggregates the chunks of f on ScanWorkers goroutines, each into
+// its own partial state, and merges the partial states into agg and fx in file
+// order, so groups and missing rates keep their first-seen order. Rows after a
+// malformed record are left out, as in a sequential scan. progress is called
+// after every merged chunk with the rows and bytes merged so far.
+func (p *scanPlan) scanParallel(ctx context.Context, f *os.File, chunks []csvutil.Chunk, agg *aggregation, fx *fxConverter, progress func(rows int, bytesRead int64)) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	workers := max(1, min(ScanWorkers, len(chunks)))
+	results := make([]chan chunkResult, len(chunks))
+	next := make(chan int, len(chunks))
+	for i := range chunks {
+		results[i] = make(chan chunkResult, 1)
+		next <- i
+	}
+	close(next)
+	// Bound the chunks scanned ahead of the merge, and so the partial states held
+	// in memory at once.
+	ahead := make(chan struct{}, 2*workers)
+	// Workers fork empty templates, as agg and fx change while chunks are merged.
+	aggTemplate, fxTemplate := agg.fork(), fx.fork()
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case ahead <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				i, ok := <-next
+				if !ok {
+					return
+				}
+				c := chunks[i]
+				r := csv.NewReader(io.NewSectionReader(f, c.Start, c.End-c.Start))
+				r.FieldsPerRecord = -1
+				res := chunkResult{agg: aggTemplate.fork(), fx: fxTemplate.fork()}
+				res.rows, res.parseErr, res.err = p.scanRows(ctx, chunkReader{r, c.Start}, res.agg, res.fx, nil)
+				results[i] <- res
+			}
+		}()
+	}
+
+	rows := 0
+	for i, c := range chunks {
+		var res chunkResult
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return rows, contextError(ctx)
+		}
+		<-ahead
+		if res.err != nil {
+			return rows, res.err
+		}
+		if err := agg.merge(res.agg); err != nil {
+			return rows, err
+		}
+		fx.merge(res.fx)
+		rows += res.rows
+		if progress != nil {
+			progress(rows, c.End)
+		}
+		if res.parseErr != nil {
+			log.Printf("error reading csv row: %v", res.parseErr)
+			break
+		}
+	}
+	return rows, nil
+}
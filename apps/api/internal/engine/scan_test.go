@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunReportParallel(t *testing.T) {
+	tmpDir := t.TempDir()
+	fxPath := filepath.Join(tmpDir, "fx.csv")
+	if err := os.WriteFile(fxPath, []byte("date,from,to,rate\n2026-01-01,EUR,USD,1.10\n2026-03-01,EUR,USD,1.25\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("id,date,customer,currency,amount,note\n")
+	currencies := []string{"USD", "EUR", "JPY"}
+	for i := 0; i < 3000; i++ {
+		note := "plain"
+		if i%7 == 0 {
+			note = "\"multi\nline, \"\"quoted\"\"\n\""
+		}
+		fmt.Fprintf(&sb, "%d,2026-%02d-%02d,cust-%d,%s,%d.%02d,%s\n",
+			i, 1+i%6, 1+i%28, (i*7919)%97, currencies[i%3], i%500, i%100, note)
+	}
+	csvPath := filepath.Join(tmpDir, "invoices.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Malformed: the bare quote on row 1500 ends the scan there.
+	lines := strings.SplitAfter(sb.String(), "\n")
+	lines[1500] = "x,2026-01-01,cust-\"bad,USD,1.00,plain\n"
+	brokenPath := filepath.Join(tmpDir, "broken.csv")
+	if err := os.WriteFile(brokenPath, []byte(strings.Join(lines, "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := map[string]ReportRequest{
+		"groups in first-seen order": {
+			GroupBy: []string{"customer"},
+			Metrics: []Metric{{Op: "count"}, {Op: "sum", Field: "amount"}, {Op: "avg", Field: "amount"}},
+			Filters: []Filter{{Field: "note", Op: "neq", Value: "skip"}},
+		},
+		"time buckets, windows and sort": {
+			GroupBy:    []string{"currency", "date"},
+			Metrics:    []Metric{{Op: "sum", Field: "amount"}},
+			TimeBucket: &TimeBucket{Field: "date", Grain: GrainWeek, FillGaps: true},
+			Windows:    []WindowMetric{{Op: "cumsum", Metric: "sum(amount)", PartitionBy: []string{"currency"}}},
+			Sort:       "sum(amount)",
+			Desc:       true,
+			Limit:      20,
+		},
+		"approximate": {
+			GroupBy:     []string{"currency"},
+			Metrics:     []Metric{{Op: "count_distinct", Field: "id"}},
+			Approximate: true,
+		},
+		"approximate with sampling": {
+			GroupBy:     []string{"customer"},
+			Metrics:     []Metric{{Op: "count"}, {Op: "sum", Field: "amount"}, {Op: "median", Field: "amount"}},
+			Approximate: true,
+			SampleRate:  0.5,
+		},
+		"currency conversion": {
+			GroupBy:  []string{"currency"},
+			Metrics:  []Metric{{Op: "sum", Field: "amount"}},
+			Currency: &CurrencyConversion{FXPath: fxPath, Target: "USD", DateField: "date"},
+		},
+	}
+
+	run := func(path string, req ReportRequest, workers int) (ReportResponse, []Progress) {
+		t.Helper()
+		defer func(w int, size int64) { ScanWorkers, ScanChunkBytes = w, size }(ScanWorkers, ScanChunkBytes)
+		ScanWorkers, ScanChunkBytes = workers, 4096
+
+		var updates []Progress
+		resp, err := RunReportWithProgress(context.Background(), path, req, func(p Progress) {
+			updates = append(updates, p)
+		})
+		if err != nil {
+			t.Fatalf("RunReportWithProgress failed: %v", err)
+		}
+		return resp, updates
+	}
+
+	for name, req := range requests {
+		for _, path := range []string{csvPath, brokenPath} {
+			t.Run(name+" "+filepath.Base(path), func(t *testing.T) {
+				want, _ := run(path, req, 1)
+				got, updates := run(path, req, 4)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("parallel result differs from sequential:\n got %v\nwant %v", got, want)
+				}
+				if len(updates) < 2 || updates[len(updates)-1].RowsScanned != want.RowsScanned {
+					t.Errorf("unexpected progress updates: %+v", updates)
+				}
+			})
+		}
+	}
+}
+
+func TestGroupMemoryBudget(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("id,amount\n")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&sb, "%d,1.00\n", i)
+	}
+	csvPath := filepath.Join(t.TempDir(), "ids.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(budget, size int64, workers int) {
+		GroupMemoryBudget, ScanChunkBytes, ScanWorkers = budget, size, workers
+	}(GroupMemoryBudget, ScanChunkBytes, ScanWorkers)
+	GroupMemoryBudget = 100 * 1024
+
+	req := ReportRequest{GroupBy: []string{"id"}, Metrics: []Metric{{Op: "sum", Field: "amount"}}}
+	for _, workers := range []int{1, 4} {
+		ScanWorkers, ScanChunkBytes = workers, 4096
+		_, err := RunReport(context.Background(), csvPath, req)
+		if !errors.Is(err, ErrTooManyGroups) || !strings.Contains(err.Error(), "distinct groups") {
+			t.Errorf("workers %d: expected ErrTooManyGroups, got %v", workers, err)
+		}
+	}
+
+	req.GroupBy = nil
+	if _, err := RunReport(context.Background(), csvPath, req); err != nil {
+		t.Errorf("expected a single group to fit the budget, got %v", err)
+	}
+}
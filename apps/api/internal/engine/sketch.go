@@ -0,0 +1,259 @@
+package engine
+
+import (
+	"cmp"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// HyperLogLog parameters: 2^14 registers give a relative standard error of
+// 1.04/sqrt(2^14), about 0.81%.
+const (
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+	// hllSparseMax is the number of distinct hashes a sketch keeps exactly
+	// before it switches to registers, so small groups stay small and exact.
+	hllSparseMax = 256
+)
+
+var hllStdError = 1.04 / math.Sqrt(hllRegisters)
+
+// hyperLogLog estimates the number of distinct values it was given.
+type hyperLogLog struct {
+	sparse    []uint64
+	registers []uint8
+}
+
+func (h *hyperLogLog) add(x uint64) {
+	if h.registers != nil {
+		h.insert(x)
+		return
+	}
+	if slices.Contains(h.sparse, x) {
+		return
+	}
+	h.sparse = append(h.sparse, x)
+	if len(h.sparse) > hllSparseMax {
+		h.densify()
+	}
+}
+
+func (h *hyperLogLog) densify() {
+	h.registers = make([]uint8, hllRegisters)
+	for _, x := range h.sparse {
+		h.insert(x)
+	}
+	h.sparse = nil
+}
+
+// insert records a hash in its register: the first hllPrecision bits pick the
+// register, which keeps the highest position of the first set bit of the rest.
+func (h *hyperLogLog) insert(x uint64) {
+	idx := x >> (64 - hllPrecision)
+	rho := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rho > h.registers[idx] {
+		h.registers[idx] = rho
+	}
+}
+
+// merge adds the values of o to h, as if h had been given them too.
+func (h *hyperLogLog) merge(o *hyperLogLog) {
+	if o.registers == nil {
+		for _, x := range o.sparse {
+			h.add(x)
+		}
+		return
+	}
+	if h.registers == nil {
+		h.densify()
+	}
+	for i, r := range o.registers {
+		h.registers[i] = max(h.registers[i], r)
+	}
+}
+
+// estimate returns the number of distinct values, exactly while the sketch is
+// sparse. Small cardinalities use linear counting.
+func (h *hyperLogLog) estimate() int64 {
+	if h.registers == nil {
+		return int64(len(h.sparse))
+	}
+	const m = float64(hllRegisters)
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(e))
+}
+
+func (h *hyperLogLog) bytes() int64 {
+	return int64(8*len(h.sparse) + len(h.registers))
+}
+
+// hashString hashes s with 64-bit FNV-1a followed by a finalizer that spreads
+// every input bit over the result, as HyperLogLog needs uniform hashes.
+func hashString(s string) uint64 {
+	return mix64(fnv1a(fnvOffset, s))
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+func fnv1a(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime
+	}
+	return h
+}
+
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// KLL parameters. kllK bounds the items of the top level; lower levels hold
+// geometrically fewer, down to kllMinWidth.
+const (
+	kllK        = 200
+	kllMinWidth = 8
+)
+
+// kllRankError is the normalized rank error of a single quantile of a KLL
+// sketch with parameter kllK, at 99% confidence.
+var kllRankError = 2.296 / math.Pow(kllK, 0.9723)
+
+// kllSketch estimates quantiles in bounded memory. Level h holds items that
+// stand for 2^h values each; once the sketch is full, a full level is sorted
+// and every other item is promoted to the next level. Compactions alternate
+// between keeping the odd and the even items, so results are reproducible.
+type kllSketch struct {
+	levels [][]float64
+	n      int64
+	odd    bool
+}
+
+func (s *kllSketch) add(x float64) {
+	if s.levels == nil {
+		s.levels = [][]float64{nil}
+	}
+	s.levels[0] = append(s.levels[0], x)
+	s.n++
+	s.compress()
+}
+
+// merge adds the values of o to s.
+func (s *kllSketch) merge(o *kllSketch) {
+	for h, level := range o.levels {
+		if h == len(s.levels) {
+			s.levels = append(s.levels, nil)
+		}
+		s.levels[h] = append(s.levels[h], level...)
+	}
+	s.n += o.n
+	s.compress()
+}
+
+func (s *kllSketch) capacity(level int) int {
+	depth := len(s.levels) - 1 - level
+	return max(kllMinWidth, int(math.Ceil(kllK*math.Pow(2.0/3, float64(depth)))))
+}
+
+// compress compacts levels while the sketch holds more items than its levels
+// have capacity for in total, each time the lowest level at its capacity.
+func (s *kllSketch) compress() {
+	for {
+		size, total, h := 0, 0, -1
+		for i, level := range s.levels {
+			size += len(level)
+			total += s.capacity(i)
+			if h < 0 && len(level) >= s.capacity(i) {
+				h = i
+			}
+		}
+		if size < total || h < 0 {
+			return
+		}
+		s.compact(h)
+	}
+}
+
+// compact sorts level h and promotes every other item to the next level.
+func (s *kllSketch) compact(h int) {
+	if h+1 == len(s.levels) {
+		s.levels = append(s.levels, nil)
+	}
+	level := s.levels[h]
+	slices.Sort(level)
+	// An odd item out stays behind.
+	var rest []float64
+	if len(level)%2 == 1 {
+		rest = []float64{level[len(level)-1]}
+		level = level[:len(level)-1]
+	}
+	start := 0
+	if s.odd {
+		start = 1
+	}
+	s.odd = !s.odd
+	for i := start; i < len(level); i += 2 {
+		s.levels[h+1] = append(s.levels[h+1], level[i])
+	}
+	s.levels[h] = append(level[:0], rest...)
+}
+
+// compacted reports whether the sketch dropped values, so that its quantiles
+// are no longer exact.
+func (s *kllSketch) compacted() bool {
+	return len(s.levels) > 1
+}
+
+// quantile returns the smallest retained value whose rank reaches q*n.
+func (s *kllSketch) quantile(q float64) float64 {
+	type item struct {
+		value  float64
+		weight int64
+	}
+	var items []item
+	for h, level := range s.levels {
+		for _, v := range level {
+			items = append(items, item{v, 1 << h})
+		}
+	}
+	if len(items) == 0 {
+		return 0
+	}
+	slices.SortFunc(items, func(a, b item) int { return cmp.Compare(a.value, b.value) })
+	target := q * float64(s.n)
+	var rank int64
+	for _, it := range items {
+		rank += it.weight
+		if float64(rank) >= target {
+			return it.value
+		}
+	}
+	return items[len(items)-1].value
+}
+
+func (s *kllSketch) bytes() int64 {
+	var n int64
+	for _, level := range s.levels {
+		n += 8 * int64(len(level))
+	}
+	return n
+}
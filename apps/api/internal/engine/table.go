@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+)
+
+// forEachRow streams a CSV file and calls fn with the values of the named columns
+// for every data row matching filters, in the order the columns were given. An
+// empty column name is optional and always yields an empty value. It returns the
+// number of rows read.
+func forEachRow(ctx context.Context, filePath string, columns []string, filters []Filter, fn func(values []string) error) (int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open report file: %w", err)
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	headers, err := csvReader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read csv headers: %w", err)
+	}
+	headerMap := indexHeaders(headers)
+	compiled, err := compileFilters(headerMap, filters)
+	if err != nil {
+		return 0, err
+	}
+
+	indices := make([]int, len(columns))
+	for i, c := range columns {
+		indices[i] = -1
+		if c == "" {
+			continue
+		}
+		idx, ok := headerMap[c]
+		if !ok {
+			return 0, fmt.Errorf("invalid column: %s", c)
+		}
+		indices[i] = idx
+	}
+
+	rows := 0
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, fmt.Errorf("failed to read csv row: %w", err)
+		}
+		rows++
+		if err := checkContext(ctx, rows); err != nil {
+			return rows, err
+		}
+		if !matchFilters(compiled, row) {
+			continue
+		}
+
+		values := make([]string, len(indices))
+		for i, idx := range indices {
+			if idx >= 0 && idx < len(row) {
+				values[i] = row[idx]
+			}
+		}
+		if err := fn(values); err != nil {
+			return rows, err
+		}
+	}
+}
+
+// readHeader returns the column names of a CSV file.
+func readHeader(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report file: %w", err)
+	}
+	defer f.Close()
+
+	headers, err := csv.NewReader(f).Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv headers: %w", err)
+	}
+	return headers, nil
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Gap fill modes for Metric.Fill.
+const (
+	FillZero     = "zero"
+	FillNull     = "null"
+	FillPrevious = "previous"
+)
+
+// TimeBucket groups the Field group-by column into periods of Grain, labelled
+// like "2026-03" for months. Rows whose date cannot be parsed or falls outside
+// From and To are skipped. With FillGaps, every period between From and To (or
+// the first and last period seen) is reported for each combination of the other
+// group-by columns, and missing periods are filled as set by each metric's Fill.
+type TimeBucket struct {
+	Field    string `json:"field"`
+	Grain    string `json:"grain"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	FillGaps bool   `json:"fillGaps,omitempty"`
+}
+
+type bucketInfo struct {
+	pos      int
+	width    int
+	idx      int
+	grain    string
+	from, to time.Time
+	fill     bool
+	periods  map[string]time.Time
+}
+
+func compileTimeBucket(tb *TimeBucket, groupBy []string, headerMap map[string]int) (*bucketInfo, error) {
+	if tb == nil {
+		return nil, nil
+	}
+	b := &bucketInfo{
+		pos:     slices.Index(groupBy, tb.Field),
+		width:   len(groupBy),
+		idx:     headerMap[tb.Field],
+		grain:   defaultString(tb.Grain, GrainMonth),
+		fill:    tb.FillGaps,
+		periods: make(map[string]time.Time),
+	}
+	if b.pos < 0 {
+		return nil, fmt.Errorf("invalid time bucket field: %s is not a groupBy column", tb.Field)
+	}
+	if !validGrain(b.grain) {
+		return nil, fmt.Errorf("invalid grain: %s", tb.Grain)
+	}
+	for _, bound := range []struct {
+		name, value string
+		dst         *time.Time
+	}{{"from", tb.From, &b.from}, {"to", tb.To, &b.to}} {
+		if bound.value == "" {
+			continue
+		}
+		t, ok := parseDate(bound.value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s date: %s", bound.name, bound.value)
+		}
+		*bound.dst = truncateDate(t, b.grain)
+	}
+	if !b.from.IsZero() && !b.to.IsZero() && b.to.Before(b.from) {
+		return nil, fmt.Errorf("invalid time bucket range: %s is after %s", tb.From, tb.To)
+	}
+	return b, nil
+}
+
+// label returns the period label of a row's date, or false when the row falls
+// outside the bucket range.
+func (b *bucketInfo) label(value string) (string, bool) {
+	t, ok := parseDate(value)
+	if !ok {
+		return "", false
+	}
+	return b.labelDate(t)
+}
+
+// labelDate is label for a parsed date.
+func (b *bucketInfo) labelDate(t time.Time) (string, bool) {
+	t = truncateDate(t, b.grain)
+	if (!b.from.IsZero() && t.Before(b.from)) || (!b.to.IsZero() && t.After(b.to)) {
+		return "", false
+	}
+	label := periodLabel(t, b.grain)
+	b.periods[label] = t
+	return label, true
+}
+
+// fork returns a copy of b with its own record of the periods seen, for one
+// chunk of a parallel scan. It returns nil when b is nil.
+func (b *bucketInfo) fork() *bucketInfo {
+	if b == nil {
+		return nil
+	}
+	part := *b
+	part.periods = make(map[string]time.Time)
+	return &part
+}
+
+// merge adds the periods seen by a chunk's bucket to b's.
+func (b *bucketInfo) merge(part *bucketInfo) {
+	if b == nil {
+		return
+	}
+	maps.Copy(b.periods, part.periods)
+}
+
+// fillGaps returns the group keys with every period of the range present for
+// each series, a series being a combination of the other group-by values.
+// Series keep their first-seen order and their periods ascend. It fails with
+// ErrTooManyGroups, before filling anything, when that takes more than
+// maxGroups keys; zero means no bound.
+func (b *bucketInfo) fillGaps(keys [][]string, maxGroups int) ([][]string, error) {
+	from, to := b.from, b.to
+	for _, t := range b.periods {
+		if b.from.IsZero() && (from.IsZero() || t.Before(from)) {
+			from = t
+		}
+		if b.to.IsZero() && t.After(to) {
+			to = t
+		}
+	}
+	if from.IsZero() || to.IsZero() {
+		return keys, nil
+	}
+
+	var series [][]string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if sk := b.series(key); !seen[sk] {
+			seen[sk] = true
+			series = append(series, key)
+		}
+	}
+	if len(series) == 0 && b.width == 1 {
+		series = append(series, []string{""})
+	}
+
+	periods := 0
+	for t := from; !t.After(to); t = addPeriods(t, b.grain, 1) {
+		periods++
+		if maxGroups > 0 && periods*len(series) > maxGroups {
+			return nil, fmt.Errorf("%w: filling gaps needs more than %d groups for %d series from %s to %s, more than the aggregation memory budget of %.1f MB allows; narrow the range, use a coarser grain or group by fewer columns",
+				ErrTooManyGroups, maxGroups, len(series), periodLabel(from, b.grain), periodLabel(to, b.grain), float64(GroupMemoryBudget)/(1<<20))
+		}
+	}
+
+	filled := make([][]string, 0, periods*len(series))
+	for _, key := range series {
+		for t := from; !t.After(to); t = addPeriods(t, b.grain, 1) {
+			k := slices.Clone(key)
+			k[b.pos] = periodLabel(t, b.grain)
+			filled = append(filled, k)
+		}
+	}
+	return filled, nil
+}
+
+// series identifies the series of a group key, ignoring its period.
+func (b *bucketInfo) series(key []string) string {
+	k := slices.Clone(key)
+	k[b.pos] = ""
+	return strings.Join(k, "\x1f")
+}
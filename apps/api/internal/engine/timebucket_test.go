@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReportTimeBuckets(t *testing.T) {
+	csvContent := `region,invoice_date,amount
+EU,2026-01-05,100
+EU,2026-01-20,50
+EU,2026-04-02,200
+US,2026-02-11,80
+US,not a date,999
+`
+	csvPath := filepath.Join(t.TempDir(), "invoices.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+
+	run := func(t *testing.T, req ReportRequest) []string {
+		t.Helper()
+		resp, err := RunReport(context.Background(), csvPath, req)
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		var rows []string
+		for _, row := range resp.Rows {
+			rows = append(rows, strings.Join(row, ","))
+		}
+		return rows
+	}
+
+	t.Run("buckets without gap filling", func(t *testing.T) {
+		got := run(t, ReportRequest{
+			GroupBy:    []string{"invoice_date"},
+			Metrics:    []Metric{{Op: "sum", Field: "amount"}},
+			TimeBucket: &TimeBucket{Field: "invoice_date", Grain: GrainMonth},
+		})
+		want := "2026-01,150.00|2026-04,200.00|2026-02,80.00"
+		if strings.Join(got, "|") != want {
+			t.Errorf("expected %s, got %v", want, got)
+		}
+	})
+
+	t.Run("fills every period per series", func(t *testing.T) {
+		got := run(t, ReportRequest{
+			GroupBy: []string{"region", "invoice_date"},
+			Metrics: []Metric{
+				{Op: "sum", Field: "amount"},
+				{Op: "count", Fill: FillNull},
+				{Op: "sum", Field: "amount", Fill: FillPrevious},
+			},
+			TimeBucket: &TimeBucket{Field: "invoice_date", Grain: GrainMonth, From: "2026-01-01", To: "2026-04-30", FillGaps: true},
+		})
+		want := []string{
+			"EU,2026-01,150.00,2,150.00",
+			"EU,2026-02,0.00,,150.00",
+			"EU,2026-03,0.00,,150.00",
+			"EU,2026-04,200.00,1,200.00",
+			"US,2026-01,0.00,,",
+			"US,2026-02,80.00,1,80.00",
+			"US,2026-03,0.00,,80.00",
+			"US,2026-04,0.00,,80.00",
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("range limits rows and feeds window metrics", func(t *testing.T) {
+		got := run(t, ReportRequest{
+			GroupBy:    []string{"invoice_date"},
+			Metrics:    []Metric{{Op: "sum", Field: "amount"}},
+			Windows:    []WindowMetric{{Op: WindowCumSum, Metric: "sum(amount)"}},
+			TimeBucket: &TimeBucket{Field: "invoice_date", Grain: GrainQuarter, To: "2026-03-31", FillGaps: true},
+		})
+		want := "2026-Q1,230.00,230.00"
+		if strings.Join(got, "|") != want {
+			t.Errorf("expected %s, got %v", want, got)
+		}
+	})
+
+	t.Run("gap filling over the group budget", func(t *testing.T) {
+		defer func(budget int64) { GroupMemoryBudget = budget }(GroupMemoryBudget)
+		GroupMemoryBudget = 64 << 10
+
+		req := ReportRequest{
+			GroupBy:    []string{"region", "invoice_date"},
+			Metrics:    []Metric{{Op: "count"}},
+			TimeBucket: &TimeBucket{Field: "invoice_date", Grain: GrainDay, From: "1900-01-01", To: "2099-12-31", FillGaps: true},
+		}
+		if _, err := RunReport(context.Background(), csvPath, req); !errors.Is(err, ErrTooManyGroups) {
+			t.Errorf("expected ErrTooManyGroups, got %v", err)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, req := range []ReportRequest{
+			{GroupBy: []string{"region"}, TimeBucket: &TimeBucket{Field: "invoice_date"}},
+			{GroupBy: []string{"invoice_date"}, TimeBucket: &TimeBucket{Field: "invoice_date", Grain: "hour"}},
+			{GroupBy: []string{"invoice_date"}, TimeBucket: &TimeBucket{Field: "invoice_date", From: "2026-05-01", To: "2026-01-01"}},
+			{GroupBy: []string{"invoice_date"}, Metrics: []Metric{{Op: "count", Fill: "linear"}}},
+		} {
+			if _, err := RunReport(context.Background(), csvPath, req); err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("%+v: expected invalid error, got %v", req, err)
+			}
+		}
+	})
+}
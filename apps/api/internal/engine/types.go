@@ -1,24 +1,72 @@
 package engine
 
 // ReportRequest defines the parameters for generating a report, including
-// grouping, metrics, filters, and row limits.
+// grouping, metrics, filters, joins, and row limits. Joined columns can be used
+// anywhere a column of the report itself can.
 type ReportRequest struct {
 	GroupBy []string `json:"groupBy"`
-	Metrics []struct {
-		Op    string `json:"op"`
-		Field string `json:"field,omitempty"`
-	} `json:"metrics"`
-	Filters []struct {
-		Field string `json:"field"`
-		Op    string `json:"op"`
-		Value string `json:"value"`
-	} `json:"filters"`
-	Limit int `json:"limit"`
+	Metrics []Metric `json:"metrics"`
+	// Windows are evaluated over the aggregated rows and appended after Metrics.
+	Windows []WindowMetric `json:"windows,omitempty"`
+	Filters []Filter       `json:"filters"`
+	Joins   []Join         `json:"joins,omitempty"`
+	Limit   int            `json:"limit"`
+	// Sort orders the result rows by one of its columns before Limit is applied,
+	// descending when Desc is set.
+	Sort string `json:"sort,omitempty"`
+	Desc bool   `json:"desc,omitempty"`
+	// TimeBucket buckets a date group-by column into periods and can fill gaps.
+	TimeBucket *TimeBucket `json:"timeBucket,omitempty"`
+	// Currency converts sum, avg, median and percentile metrics into a single
+	// reporting currency.
+	Currency *CurrencyConversion `json:"currency,omitempty"`
+	// Approximate trades exactness for speed and memory on very large files:
+	// count_distinct uses a HyperLogLog sketch and median and percentile a KLL
+	// sketch. SampleRate, from 0 (exclusive) to 1, additionally aggregates only
+	// that fraction of the rows, picked uniformly, and scales counts and sums up
+	// to the whole file. The response then reports error bounds and the sample
+	// size in Approximation.
+	Approximate bool    `json:"approximate,omitempty"`
+	SampleRate  float64 `json:"sampleRate,omitempty"`
+}
+
+// Metric is an aggregation ("count", "sum" or "avg") over an optional field, or
+// one of "count_distinct" (the number of distinct non-empty values), "median"
+// and "percentile" over a field. Percentile is the percentile, from 0 to 100, of
+// a percentile metric; exact medians and percentiles interpolate between the
+// two closest values. Sums, averages and percentiles are computed with exact
+// decimal arithmetic and rounded only when formatted, to Scale decimal places
+// (default 2) using Rounding, either "half_up" (default) or "half_even"
+// (banker's rounding, also "bankers"). Fill sets the value of periods added by
+// gap filling: "zero" (default), "null" (an empty value) or "previous" (carried
+// forward from the prior period).
+type Metric struct {
+	Op         string   `json:"op"`
+	Field      string   `json:"field,omitempty"`
+	Percentile *float64 `json:"percentile,omitempty"`
+	Scale      *int     `json:"scale,omitempty"`
+	Rounding   string   `json:"rounding,omitempty"`
+	Fill       string   `json:"fill,omitempty"`
+}
+
+// Filter restricts the rows that take part in aggregation. Supported operators are
+// "eq", "neq", "contains", "gt", "gte", "lt" and "lte". Ordering operators compare
+// numerically when both sides are numbers and lexically otherwise, which also
+// orders ISO-8601 dates correctly.
+type Filter struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
 }
 
 // ReportResponse contains the aggregated results of a report execution.
+// Currency and MissingRates are set when amounts were converted, and
+// Approximation when the report was approximate.
 type ReportResponse struct {
-	Columns     []string   `json:"columns"`
-	Rows        [][]string `json:"rows"`
-	RowsScanned int        `json:"rowsScanned"`
+	Columns       []string       `json:"columns"`
+	Rows          [][]string     `json:"rows"`
+	RowsScanned   int            `json:"rowsScanned"`
+	Currency      string         `json:"currency,omitempty"`
+	MissingRates  []MissingRate  `json:"missingRates,omitempty"`
+	Approximation *Approximation `json:"approximation,omitempty"`
 }
@@ -0,0 +1,331 @@
+package engine
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+)
+
+// Window metric operators for WindowMetric.Op.
+const (
+	WindowCumSum      = "cumsum"
+	WindowDiff        = "diff"
+	WindowPctChange   = "pct_change"
+	WindowMovingAvg   = "moving_avg"
+	WindowRank        = "rank"
+	WindowDenseRank   = "dense_rank"
+	WindowPctOfTotal  = "pct_of_total"
+	WindowPctOfParent = "pct_of_parent"
+	WindowABC         = "abc"
+)
+
+// DefaultMovingWindow is the number of rows averaged by moving_avg.
+const DefaultMovingWindow = 3
+
+// DefaultABCThresholds are the cumulative shares, in percent, that close the A
+// and B classes of an abc window metric.
+var DefaultABCThresholds = []float64{80, 95}
+
+// WindowMetric is evaluated over the aggregated rows of a report rather than the
+// raw CSV rows. Metric names the metric it reads by its result column, e.g.
+// "sum(amount)". Rows are split into partitions by the PartitionBy group-by
+// columns; cumsum, diff, pct_change and moving_avg walk each partition in
+// OrderBy order (the report's row order by default), rank and dense_rank order
+// by the metric value, highest first, and pct_of_total divides by the partition
+// total. pct_of_parent divides by the total of the enclosing group-by level, that
+// is all group-by columns but the last, and ignores PartitionBy. abc labels rows
+// "A", "B" or "C" by the cumulative share of the rows ranked above them: a row is
+// A while that share is below Thresholds[0] and B while it is below
+// Thresholds[1]. Percentages are returned as percent values with two decimals
+// unless Scale says otherwise.
+type WindowMetric struct {
+	Op          string   `json:"op"`
+	Metric      string   `json:"metric"`
+	PartitionBy []string `json:"partitionBy,omitempty"`
+	OrderBy     []string `json:"orderBy,omitempty"`
+	// Window is the number of rows averaged by moving_avg, including the
+	// current one.
+	Window int `json:"window,omitempty"`
+	// Thresholds are the abc class boundaries, defaulting to
+	// DefaultABCThresholds.
+	Thresholds []float64 `json:"thresholds,omitempty"`
+	// Scale and Rounding format the result like those of Metric. They default
+	// to the metric's for amounts and to two places rounded half up for
+	// percentages, and are rejected by rank, dense_rank and abc.
+	Scale    *int   `json:"scale,omitempty"`
+	Rounding string `json:"rounding,omitempty"`
+}
+
+type windowInfo struct {
+	op        string
+	name      string
+	metric    int
+	partition []int
+	order     []int
+	window    int
+	abc       [2]*big.Rat
+	scale     int
+	rounding  string
+}
+
+// compileWindows resolves window metrics against the group-by columns and the
+// result columns of the regular metrics.
+func compileWindows(groupBy []string, metrics []metricInfo, windows []WindowMetric) ([]windowInfo, error) {
+	var compiled []windowInfo
+	for _, w := range windows {
+		info := windowInfo{op: w.Op, metric: -1, window: w.Window, scale: DefaultScale, rounding: w.Rounding}
+		switch w.Op {
+		case WindowCumSum, WindowDiff, WindowPctChange, WindowRank, WindowDenseRank, WindowPctOfTotal, WindowPctOfParent:
+		case WindowABC:
+			thresholds := w.Thresholds
+			if thresholds == nil {
+				thresholds = DefaultABCThresholds
+			}
+			if len(thresholds) != 2 || thresholds[0] <= 0 || thresholds[0] > thresholds[1] || thresholds[1] > 100 {
+				return nil, fmt.Errorf("invalid abc thresholds: %v", w.Thresholds)
+			}
+			for i, pct := range thresholds {
+				// Go through the shortest decimal form so that 80 means exactly 0.8.
+				info.abc[i], _ = new(big.Rat).SetString(strconv.FormatFloat(pct, 'f', -1, 64))
+				info.abc[i].Quo(info.abc[i], big.NewRat(100, 1))
+			}
+		case WindowMovingAvg:
+			if info.window == 0 {
+				info.window = DefaultMovingWindow
+			}
+			if info.window < 1 {
+				return nil, fmt.Errorf("invalid moving average window: %d", w.Window)
+			}
+		default:
+			return nil, fmt.Errorf("invalid window op: %s", w.Op)
+		}
+		for i, m := range metrics {
+			if m.name() == w.Metric {
+				info.metric = i
+				info.scale = m.scale
+				if info.rounding == "" {
+					info.rounding = m.rounding
+				}
+			}
+		}
+		if info.metric < 0 {
+			return nil, fmt.Errorf("invalid window metric: %s", w.Metric)
+		}
+		switch w.Op {
+		case WindowRank, WindowDenseRank, WindowABC:
+			if w.Scale != nil || w.Rounding != "" {
+				return nil, fmt.Errorf("invalid window metric: %s takes no scale or rounding", w.Op)
+			}
+		case WindowPctChange, WindowPctOfTotal, WindowPctOfParent:
+			info.scale, info.rounding = 2, defaultString(w.Rounding, RoundHalfUp)
+		}
+		if w.Scale != nil {
+			if *w.Scale < 0 || *w.Scale > 18 {
+				return nil, fmt.Errorf("invalid metric scale: %d", *w.Scale)
+			}
+			info.scale = *w.Scale
+		}
+		if !validRounding(info.rounding) {
+			return nil, fmt.Errorf("invalid rounding mode: %s", w.Rounding)
+		}
+
+		var err error
+		partitionBy := w.PartitionBy
+		if w.Op == WindowPctOfParent {
+			partitionBy = groupBy[:max(len(groupBy)-1, 0)]
+		}
+		if info.partition, err = groupColumns(groupBy, partitionBy, "partition"); err != nil {
+			return nil, err
+		}
+		if info.order, err = groupColumns(groupBy, w.OrderBy, "order"); err != nil {
+			return nil, err
+		}
+
+		info.name = w.Op + "(" + w.Metric + ")"
+		if w.Op == WindowMovingAvg {
+			info.name = fmt.Sprintf("%s(%s,%d)", w.Op, w.Metric, info.window)
+		}
+		compiled = append(compiled, info)
+	}
+	return compiled, nil
+}
+
+// groupColumns maps column names to their position among the group-by columns.
+func groupColumns(groupBy, names []string, role string) ([]int, error) {
+	var idx []int
+	for _, name := range names {
+		i := slices.Index(groupBy, name)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid window %s column: %s", role, name)
+		}
+		idx = append(idx, i)
+	}
+	return idx, nil
+}
+
+// eval computes the window metric for every aggregated row. keys holds
+// each row's group-by values and values its exact metric values.
+func (w windowInfo) eval(keys [][]string, values [][]*big.Rat) []string {
+	out := make([]string, len(keys))
+	for _, rows := range partitionRows(keys, w.partition) {
+		switch w.op {
+		case WindowRank, WindowDenseRank:
+			w.rank(rows, values, out)
+			continue
+		case WindowABC:
+			w.classify(rows, values, out)
+			continue
+		case WindowPctOfTotal, WindowPctOfParent:
+			total := new(big.Rat)
+			for _, r := range rows {
+				total.Add(total, values[r][w.metric])
+			}
+			for _, r := range rows {
+				out[r] = percentOf(values[r][w.metric], total, w.scale, w.rounding)
+			}
+			continue
+		}
+
+		if len(w.order) > 0 {
+			slices.SortStableFunc(rows, func(a, b int) int {
+				for _, col := range w.order {
+					if c := compareValues(keys[a][col], keys[b][col]); c != 0 {
+						return c
+					}
+				}
+				return 0
+			})
+		}
+		running := new(big.Rat)
+		for i, r := range rows {
+			v := values[r][w.metric]
+			switch w.op {
+			case WindowCumSum:
+				running.Add(running, v)
+				out[r] = formatDecimal(running, w.scale, w.rounding)
+			case WindowDiff:
+				if i > 0 {
+					out[r] = formatDecimal(new(big.Rat).Sub(v, values[rows[i-1]][w.metric]), w.scale, w.rounding)
+				}
+			case WindowPctChange:
+				if i > 0 {
+					prev := values[rows[i-1]][w.metric]
+					if prev.Sign() != 0 {
+						change := new(big.Rat).Sub(v, prev)
+						out[r] = percentOf(change, new(big.Rat).Abs(prev), w.scale, w.rounding)
+					}
+				}
+			case WindowMovingAvg:
+				running.Add(running, v)
+				n := min(i+1, w.window)
+				if i >= w.window {
+					running.Sub(running, values[rows[i-w.window]][w.metric])
+				}
+				avg := new(big.Rat).Quo(running, new(big.Rat).SetInt64(int64(n)))
+				out[r] = formatDecimal(avg, w.scale, w.rounding)
+			}
+		}
+	}
+	return out
+}
+
+// rank assigns 1 to the highest value of the partition. Ties share a rank; rank
+// leaves gaps after ties and dense_rank does not.
+func (w windowInfo) rank(rows []int, values [][]*big.Rat, out []string) {
+	slices.SortStableFunc(rows, func(a, b int) int {
+		return values[b][w.metric].Cmp(values[a][w.metric])
+	})
+	rank := 0
+	for i, r := range rows {
+		if i == 0 || values[r][w.metric].Cmp(values[rows[i-1]][w.metric]) != 0 {
+			if w.op == WindowDenseRank {
+				rank++
+			} else {
+				rank = i + 1
+			}
+		}
+		out[r] = strconv.Itoa(rank)
+	}
+}
+
+// classify labels the rows of a partition A, B or C by the cumulative share of
+// the metric held by the rows ranked above them.
+func (w windowInfo) classify(rows []int, values [][]*big.Rat, out []string) {
+	slices.SortStableFunc(rows, func(a, b int) int {
+		return values[b][w.metric].Cmp(values[a][w.metric])
+	})
+	total := new(big.Rat)
+	for _, r := range rows {
+		total.Add(total, values[r][w.metric])
+	}
+	above := new(big.Rat)
+	for _, r := range rows {
+		share := new(big.Rat)
+		if total.Sign() != 0 {
+			share.Quo(above, total)
+		}
+		switch {
+		case share.Cmp(w.abc[0]) < 0:
+			out[r] = "A"
+		case share.Cmp(w.abc[1]) < 0:
+			out[r] = "B"
+		default:
+			out[r] = "C"
+		}
+		above.Add(above, values[r][w.metric])
+	}
+}
+
+// partitionRows groups row indices by the values of the partition columns,
+// keeping first-seen order.
+func partitionRows(keys [][]string, partition []int) [][]int {
+	index := make(map[string]int)
+	var parts [][]int
+	for r, key := range keys {
+		values := make([]string, len(partition))
+		for i, col := range partition {
+			values[i] = key[col]
+		}
+		pk := strings.Join(values, "\x1f")
+		p, ok := index[pk]
+		if !ok {
+			p = len(parts)
+			index[pk] = p
+			parts = append(parts, nil)
+		}
+		parts[p] = append(parts[p], r)
+	}
+	return parts
+}
+
+// percentOf formats part as a percentage of whole to scale places, or "" when
+// whole is zero.
+func percentOf(part, whole *big.Rat, scale int, rounding string) string {
+	if whole.Sign() == 0 {
+		return ""
+	}
+	pct := new(big.Rat).Quo(part, whole)
+	pct.Mul(pct, big.NewRat(100, 1))
+	return formatDecimal(pct, scale, rounding)
+}
+
+// compareValues orders two group values, numerically when both are numbers and
+// lexically otherwise.
+func compareValues(a, b string) int {
+	if x, ok := csvutil.InferNumeric(a); ok {
+		if y, ok := csvutil.InferNumeric(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
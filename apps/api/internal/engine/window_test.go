@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunReportWindows(t *testing.T) {
+	csvContent := `region,month,amount
+EU,2026-02,200
+US,2026-01,50
+EU,2026-01,100
+US,2026-02,50
+EU,2026-03,100
+US,2026-03,100
+`
+	csvPath := filepath.Join(t.TempDir(), "revenue.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+
+	resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+		GroupBy: []string{"region", "month"},
+		Metrics: []Metric{{Op: "sum", Field: "amount"}},
+		Windows: []WindowMetric{
+			{Op: WindowCumSum, Metric: "sum(amount)", PartitionBy: []string{"region"}, OrderBy: []string{"month"}},
+			{Op: WindowDiff, Metric: "sum(amount)", PartitionBy: []string{"region"}, OrderBy: []string{"month"}},
+			{Op: WindowPctChange, Metric: "sum(amount)", PartitionBy: []string{"region"}, OrderBy: []string{"month"}},
+			{Op: WindowMovingAvg, Metric: "sum(amount)", PartitionBy: []string{"region"}, OrderBy: []string{"month"}, Window: 2},
+			{Op: WindowRank, Metric: "sum(amount)", PartitionBy: []string{"region"}},
+			{Op: WindowDenseRank, Metric: "sum(amount)", PartitionBy: []string{"region"}},
+			{Op: WindowPctOfTotal, Metric: "sum(amount)"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunReport failed: %v", err)
+	}
+
+	wantColumns := []string{"region", "month", "sum(amount)", "cumsum(sum(amount))", "diff(sum(amount))",
+		"pct_change(sum(amount))", "moving_avg(sum(amount),2)", "rank(sum(amount))", "dense_rank(sum(amount))",
+		"pct_of_total(sum(amount))"}
+	if !slices.Equal(resp.Columns, wantColumns) {
+		t.Fatalf("unexpected columns: %v", resp.Columns)
+	}
+
+	want := map[string]string{
+		"EU|2026-01": "100.00,100.00,,,100.00,2,2,16.67",
+		"EU|2026-02": "200.00,300.00,100.00,100.00,150.00,1,1,33.33",
+		"EU|2026-03": "100.00,400.00,-100.00,-50.00,150.00,2,2,16.67",
+		"US|2026-01": "50.00,50.00,,,50.00,2,2,8.33",
+		"US|2026-02": "50.00,100.00,0.00,0.00,50.00,2,2,8.33",
+		"US|2026-03": "100.00,200.00,50.00,100.00,75.00,1,1,16.67",
+	}
+	if len(resp.Rows) != len(want) {
+		t.Fatalf("expected %d rows, got %v", len(want), resp.Rows)
+	}
+	for _, row := range resp.Rows {
+		key := row[0] + "|" + row[1]
+		if got := strings.Join(row[2:], ","); got != want[key] {
+			t.Errorf("%s: expected %s, got %s", key, want[key], got)
+		}
+	}
+
+	t.Run("rank leaves gaps after ties", func(t *testing.T) {
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+			GroupBy: []string{"month"},
+			Metrics: []Metric{{Op: "count"}},
+			Windows: []WindowMetric{
+				{Op: WindowRank, Metric: "count"},
+				{Op: WindowDenseRank, Metric: "count"},
+			},
+			Filters: []Filter{{Field: "amount", Op: "gt", Value: "50"}},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		// 2026-03 has two rows, 2026-01 and 2026-02 one each.
+		for _, row := range resp.Rows {
+			wantRank, wantDense := "2", "2"
+			if row[0] == "2026-03" {
+				wantRank, wantDense = "1", "1"
+			}
+			if row[2] != wantRank || row[3] != wantDense {
+				t.Errorf("%s: expected rank %s/%s, got %s/%s", row[0], wantRank, wantDense, row[2], row[3])
+			}
+		}
+	})
+
+	t.Run("percentages take scale and rounding", func(t *testing.T) {
+		scale, tenths := 4, 1
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+			GroupBy: []string{"region", "month"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
+			Windows: []WindowMetric{
+				{Op: WindowPctOfTotal, Metric: "sum(amount)", Scale: &scale},
+				{Op: WindowPctChange, Metric: "sum(amount)", PartitionBy: []string{"region"}, OrderBy: []string{"month"}, Scale: &tenths, Rounding: RoundHalfEven},
+			},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		for _, row := range resp.Rows {
+			if row[0] == "EU" && row[1] == "2026-03" && (row[3] != "16.6667" || row[4] != "-50.0") {
+				t.Errorf("expected 16.6667 and -50.0, got %v", row[3:])
+			}
+		}
+	})
+
+	t.Run("invalid windows", func(t *testing.T) {
+		for _, w := range []WindowMetric{
+			{Op: "lag", Metric: "sum(amount)"},
+			{Op: WindowCumSum, Metric: "sum(price)"},
+			{Op: WindowCumSum, Metric: "sum(amount)", PartitionBy: []string{"amount"}},
+			{Op: WindowRank, Metric: "sum(amount)", Scale: new(int)},
+			{Op: WindowABC, Metric: "sum(amount)", Rounding: RoundHalfEven},
+		} {
+			_, err := RunReport(context.Background(), csvPath, ReportRequest{
+				GroupBy: []string{"region"},
+				Metrics: []Metric{{Op: "sum", Field: "amount"}},
+				Windows: []WindowMetric{w},
+			})
+			if err == nil || !strings.Contains(err.Error(), "invalid") {
+				t.Errorf("%+v: expected invalid error, got %v", w, err)
+			}
+		}
+	})
+}
+
+func TestRunReportShareAndABC(t *testing.T) {
+	csvContent := `country,city,amount
+DE,Berlin,600
+DE,Munich,200
+FR,Paris,150
+FR,Lyon,40
+IT,Rome,10
+`
+	csvPath := filepath.Join(t.TempDir(), "sales.csv")
+	if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+		t.Fatalf("failed to create test csv: %v", err)
+	}
+
+	resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+		GroupBy: []string{"country", "city"},
+		Metrics: []Metric{{Op: "sum", Field: "amount"}},
+		Windows: []WindowMetric{
+			{Op: WindowPctOfTotal, Metric: "sum(amount)"},
+			{Op: WindowPctOfParent, Metric: "sum(amount)"},
+			{Op: WindowABC, Metric: "sum(amount)"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunReport failed: %v", err)
+	}
+
+	// Cumulative shares above each city: Berlin 0, Munich 60, Paris 80, Lyon 95, Rome 99.
+	want := map[string]string{
+		"Berlin": "60.00,75.00,A",
+		"Munich": "20.00,25.00,A",
+		"Paris":  "15.00,78.95,B",
+		"Lyon":   "4.00,21.05,C",
+		"Rome":   "1.00,100.00,C",
+	}
+	for _, row := range resp.Rows {
+		if got := strings.Join(row[3:], ","); got != want[row[1]] {
+			t.Errorf("%s: expected %s, got %s", row[1], want[row[1]], got)
+		}
+	}
+
+	t.Run("custom thresholds", func(t *testing.T) {
+		resp, err := RunReport(context.Background(), csvPath, ReportRequest{
+			GroupBy: []string{"country"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
+			Windows: []WindowMetric{{Op: WindowABC, Metric: "sum(amount)", Thresholds: []float64{50, 90}}},
+		})
+		if err != nil {
+			t.Fatalf("RunReport failed: %v", err)
+		}
+		// DE 80%, FR 19%, IT 1%: shares above are 0, 80 and 99.
+		want := map[string]string{"DE": "A", "FR": "B", "IT": "C"}
+		for _, row := range resp.Rows {
+			if row[2] != want[row[0]] {
+				t.Errorf("%s: expected %s, got %s", row[0], want[row[0]], row[2])
+			}
+		}
+	})
+
+	t.Run("invalid thresholds", func(t *testing.T) {
+		_, err := RunReport(context.Background(), csvPath, ReportRequest{
+			GroupBy: []string{"country"},
+			Metrics: []Metric{{Op: "sum", Field: "amount"}},
+			Windows: []WindowMetric{{Op: WindowABC, Metric: "sum(amount)", Thresholds: []float64{95, 80}}},
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid abc thresholds") {
+			t.Errorf("expected invalid abc thresholds error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package httpapi
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// Report export formats accepted by the run endpoints' format parameter.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// exportFormat picks the download format from the format query parameter, or
+// from the Accept header when it is absent. An empty result means the regular
+// inline JSON response.
+func exportFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case FormatJSON, FormatCSV, FormatXLSX:
+			return format, nil
+		}
+		return "", fmt.Errorf("invalid format: %s", format)
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return FormatCSV, nil
+	case strings.Contains(accept, xlsxContentType):
+		return FormatXLSX, nil
+	}
+	return "", nil
+}
+
+// exportFileName derives a download name such as
+// "sample-invoices-report-by-status.csv" from the dataset file name and the
+// report's group-by columns.
+func exportFileName(datasetName string, req engine.ReportRequest, format string) string {
+	parts := []string{"report"}
+	if len(req.GroupBy) > 0 {
+		parts = append(parts, "by")
+		parts = append(parts, req.GroupBy...)
+	}
+	return slugFileName(datasetName, parts, format)
+}
+
+// slugFileName joins the dataset file name without its extension and parts
+// into a lowercase file name of letters, digits, underscores and single dashes.
+func slugFileName(datasetName string, parts []string, format string) string {
+	base := strings.TrimSuffix(datasetName, filepath.Ext(datasetName))
+	parts = append([]string{base}, parts...)
+
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.Join(parts, "-")) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-") + "." + format
+}
+
+// writeReportExport sends resp as a file download in the given format.
+func writeReportExport(w http.ResponseWriter, format, filename string, req engine.ReportRequest, resp engine.ReportResponse) {
+	switch format {
+	case FormatCSV:
+		writeCSV(w, filename, resp.Columns, resp.Rows)
+	case FormatXLSX:
+		w.Header().Set("Content-Type", xlsxContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		// Group-by values stay text so that codes like "0042" keep their zeros.
+		if err := writeXLSX(w, "Report", resp.Columns, resp.Rows, len(req.GroupBy)); err != nil {
+			log.Printf("Error writing XLSX: %v", err)
+		}
+	default:
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// writeXLSX writes a single-sheet workbook with a frozen header row. Cells from
+// column textColumns on that hold a number are written as numeric cells.
+func writeXLSX(w io.Writer, sheetName string, header []string, rows [][]string, textColumns int) error {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+	}
+	for _, part := range parts {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, part.body); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	sb.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sb.WriteString(`<sheetData>`)
+	writeXLSXRow(&sb, 1, header, len(header))
+	for i, row := range rows {
+		writeXLSXRow(&sb, i+2, row, textColumns)
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(fw, sb.String()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeXLSXRow(sb *strings.Builder, rowNum int, values []string, textColumns int) {
+	fmt.Fprintf(sb, `<row r="%d">`, rowNum)
+	for col, value := range values {
+		ref := xlsxColumn(col) + strconv.Itoa(rowNum)
+		if col >= textColumns {
+			if n, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+				fmt.Fprintf(sb, `<c r="%s"><v>%s</v></c>`, ref, value)
+				continue
+			}
+		}
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(sb, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(value))
+	}
+	sb.WriteString(`</row>`)
+}
+
+// xlsxColumn converts a zero-based column index into its letters, e.g. 27 to "AB".
+func xlsxColumn(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	if err := xml.EscapeText(&sb, []byte(s)); err != nil {
+		return ""
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package httpapi_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestRunReportExport(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+	body := `{"groupBy":["status"],"metrics":[{"op":"count"},{"op":"sum","field":"total"}]}`
+
+	run := func(t *testing.T, query, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run"+query, strings.NewReader(body))
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		rr := run(t, "?format=csv", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="sample-invoices-report-by-status.csv"` {
+			t.Errorf("unexpected Content-Disposition: %s", got)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) < 2 || strings.Join(records[0], ",") != "status,count,sum(total)" {
+			t.Errorf("unexpected csv: %v", records)
+		}
+	})
+
+	t.Run("xlsx from accept header", func(t *testing.T) {
+		rr := run(t, "", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, `report-by-status.xlsx"`) {
+			t.Errorf("unexpected Content-Disposition: %s", got)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+		if err != nil {
+			t.Fatalf("invalid xlsx archive: %v", err)
+		}
+		var sheet string
+		for _, f := range zr.File {
+			if f.Name == "xl/worksheets/sheet1.xml" {
+				rc, _ := f.Open()
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				sheet = string(data)
+			}
+		}
+		for _, want := range []string{
+			`state="frozen"`,
+			`<c r="A1" t="inlineStr"><is><t xml:space="preserve">status</t></is></c>`,
+			`<c r="A2" t="inlineStr">`,
+			`<c r="B2"><v>`,
+		} {
+			if !strings.Contains(sheet, want) {
+				t.Errorf("sheet is missing %s", want)
+			}
+		}
+	})
+
+	t.Run("json download", func(t *testing.T) {
+		rr := run(t, "?format=json", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("Content-Disposition"); !strings.HasSuffix(got, `.json"`) {
+			t.Errorf("unexpected Content-Disposition: %s", got)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		if rr := run(t, "?format=pdf", ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+func handleAging(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filePath, ok := resolveReportPath(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+
+	var req engine.AgingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	resp, err := engine.RunAging(ctx, filePath, req)
+	if err != nil {
+		log.Printf("error running aging report: %v", err)
+		writeQueryError(w, err, "failed to run aging report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
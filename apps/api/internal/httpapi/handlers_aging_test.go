@@ -0,0 +1,53 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleAging(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	t.Run("aging on sample", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/aging", bytes.NewReader([]byte(`{"asOf":"2026-04-30"}`)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.AgingResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.AsOf != "2026-04-30" || len(resp.Buckets) != 5 || len(resp.Rows) == 0 {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("invalid buckets", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/aging", bytes.NewReader([]byte(`{"buckets":[0]}`)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("report not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/missing/aging", bytes.NewReader([]byte(`{}`)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+}
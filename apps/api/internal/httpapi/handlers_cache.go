@@ -0,0 +1,17 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"erp-export-analytics/api/internal/resultcache"
+)
+
+// handleCacheStats returns the hit and miss counters and the size of the report
+// result cache.
+func handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, resultcache.GetStats())
+}
@@ -0,0 +1,58 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"erp-export-analytics/api/internal/httpapi"
+	"erp-export-analytics/api/internal/resultcache"
+)
+
+func TestHandleCacheStats(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	resultcache.Clear()
+	defer resultcache.Clear()
+	router := httpapi.NewRouter()
+
+	run := func(cacheControl string) string {
+		t.Helper()
+		body := `{"groupBy":["status"],"metrics":[{"op":"count"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run", strings.NewReader(body))
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Get("X-Cache")
+	}
+
+	if got := run(""); got != "MISS" {
+		t.Errorf("expected first run to miss, got %q", got)
+	}
+	if got := run(""); got != "HIT" {
+		t.Errorf("expected second run to hit, got %q", got)
+	}
+	if got := run("no-cache"); got != "MISS" {
+		t.Errorf("expected no-cache run to skip the cache, got %q", got)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/cache/stats", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var stats resultcache.Stats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,34 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleCohorts(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	body := []byte(`{"customerField":"customer_id","dateField":"event_date","valueField":"mrr"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-subscriptions/cohorts", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var resp engine.CohortResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Cohorts) == 0 || resp.Cohorts[0].CustomerPct[0] != "100.00" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
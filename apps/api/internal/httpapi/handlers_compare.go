@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// CompareRequest selects the two sides of a report comparison: either two report
+// IDs, or two date ranges of DateField within a single report.
+type CompareRequest struct {
+	BaseReportID    string               `json:"baseReportId"`
+	CompareReportID string               `json:"compareReportId"`
+	ReportID        string               `json:"reportId"`
+	DateField       string               `json:"dateField"`
+	BaseRange       engine.DateRange     `json:"baseRange"`
+	CompareRange    engine.DateRange     `json:"compareRange"`
+	Report          engine.ReportRequest `json:"report"`
+}
+
+func handleCompareReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CompareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !resolveRequestFiles(w, &req.Report) {
+		return
+	}
+
+	var basePath, comparePath string
+	var baseFilters, compareFilters []engine.Filter
+	switch {
+	case req.BaseReportID != "" && req.CompareReportID != "":
+		var ok bool
+		if basePath, ok = resolveReportPath(req.BaseReportID); !ok {
+			http.Error(w, "base report not found", http.StatusNotFound)
+			return
+		}
+		if comparePath, ok = resolveReportPath(req.CompareReportID); !ok {
+			http.Error(w, "compare report not found", http.StatusNotFound)
+			return
+		}
+	case req.ReportID != "" && req.DateField != "":
+		path, ok := resolveReportPath(req.ReportID)
+		if !ok {
+			http.Error(w, "report not found", http.StatusNotFound)
+			return
+		}
+		basePath, comparePath = path, path
+		baseFilters = req.BaseRange.Filters(req.DateField)
+		compareFilters = req.CompareRange.Filters(req.DateField)
+	default:
+		http.Error(w, "either baseReportId and compareReportId, or reportId and dateField are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	resp, err := engine.CompareReports(ctx, basePath, baseFilters, comparePath, compareFilters, req.Report)
+	if err != nil {
+		log.Printf("error comparing reports: %v", err)
+		writeQueryError(w, err, "failed to compare reports")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
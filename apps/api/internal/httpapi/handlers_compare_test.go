@@ -0,0 +1,64 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleCompareReports(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	t.Run("compare date ranges of a sample", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]any{
+			"reportId":     "sample-sample-invoices",
+			"dateField":    "invoice_date",
+			"baseRange":    map[string]string{"from": "2026-01-01", "to": "2026-01-31"},
+			"compareRange": map[string]string{"from": "2026-02-01", "to": "2026-02-28"},
+			"report": map[string]any{
+				"groupBy": []string{"currency"},
+				"metrics": []map[string]any{{"op": "sum", "field": "total"}},
+			},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/compare", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.CompareResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Rows) == 0 {
+			t.Error("expected non-empty rows")
+		}
+	})
+
+	t.Run("missing sides", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/compare", bytes.NewReader([]byte(`{"baseReportId":"sample-sample-invoices"}`)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("report not found", func(t *testing.T) {
+		body := []byte(`{"baseReportId":"sample-sample-invoices","compareReportId":"missing"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/compare", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp-export-analytics/api/internal/csvutil"
+	"erp-export-analytics/api/internal/reports"
+)
+
+// Version upload modes accepted by the dataset versions endpoint.
+const (
+	versionModeReplace = "replace"
+	versionModeAppend  = "append"
+)
+
+func handleDatasetVersions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleListVersions(w, r)
+	case http.MethodPost:
+		handleAddVersion(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleListVersions(w http.ResponseWriter, r *http.Request) {
+	datasetID := r.PathValue("id")
+	versions, ok := reports.ListVersions(datasetID)
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+
+	resp := DatasetVersionsResponse{DatasetID: datasetID, Versions: []DatasetVersion{}}
+	for _, v := range versions {
+		resp.Versions = append(resp.Versions, DatasetVersion{
+			ReportID:  v.ID,
+			Version:   v.Version,
+			FileName:  v.FileName,
+			Rows:      v.Rows,
+			Columns:   v.Columns,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAddVersion stores an uploaded CSV as the next version of a dataset.
+// In replace mode the upload becomes the new version as-is and must contain every
+// column of the latest version. In append mode its rows are added to a copy of the
+// latest version and its columns must match exactly (in any order).
+func handleAddVersion(w http.ResponseWriter, r *http.Request) {
+	datasetID := r.PathValue("id")
+	latest, ok := reports.LatestVersion(datasetID)
+	if !ok {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = versionModeReplace
+	}
+	if mode != versionModeReplace && mode != versionModeAppend {
+		http.Error(w, "invalid mode: must be replace or append", http.StatusBadRequest)
+		return
+	}
+
+	upload, ok := receiveUpload(w, r)
+	if !ok {
+		return
+	}
+
+	missing, extra := csvutil.CompareColumns(latest.Columns, upload.columns)
+	if len(missing) > 0 || (mode == versionModeAppend && len(extra) > 0) {
+		discardUpload(upload)
+		msg := fmt.Sprintf("incompatible schema: missing columns [%s]", strings.Join(missing, ", "))
+		if mode == versionModeAppend {
+			msg += fmt.Sprintf(", unexpected columns [%s]", strings.Join(extra, ", "))
+		}
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+
+	if mode == versionModeAppend {
+		if err := appendVersion(r.Context(), latest, &upload); err != nil {
+			discardUpload(upload)
+			log.Printf("error appending dataset version: %v", err)
+			http.Error(w, "failed to append rows", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	cacheUpload(r.Context(), &upload)
+
+	version := reports.Report{
+		ID:        upload.reportID,
+		FilePath:  upload.filePath,
+		CreatedAt: time.Now(),
+		DatasetID: datasetID,
+		FileName:  upload.fileName,
+		Columns:   upload.columns,
+		Rows:      upload.rows,
+		RowIndex:  &upload.index,
+	}
+	if mode == versionModeReplace {
+		writeJSON(w, http.StatusCreated, newUploadResponse(reports.AddVersion(version), upload))
+		return
+	}
+
+	// An append holds the rows of latest, so it fails when another version was
+	// added in the meantime rather than drop that version's rows.
+	report, err := reports.AddVersionOn(version, latest.ID)
+	if err != nil {
+		discardUpload(upload)
+		http.Error(w, "dataset changed during append: retry against the latest version", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newUploadResponse(report, upload))
+}
+
+// discardUpload removes the files of an upload that was not stored as a report.
+func discardUpload(upload savedUpload) {
+	removeFile(upload.filePath)
+	removeFile(upload.filePath + ".merged")
+	if upload.cachePath != "" {
+		removeFile(upload.cachePath)
+	}
+}
+
+// appendVersion replaces the saved upload with the latest version's rows followed
+// by the uploaded rows, and refreshes the upload's metadata accordingly.
+func appendVersion(ctx context.Context, latest reports.Report, upload *savedUpload) error {
+	base, err := os.Open(latest.FilePath)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	extra, err := os.Open(upload.filePath)
+	if err != nil {
+		return err
+	}
+	defer extra.Close()
+
+	mergedPath := upload.filePath + ".merged"
+	dst, err := os.Create(mergedPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := csvutil.AppendCSV(ctx, dst, base, extra); err != nil {
+		removeFile(mergedPath)
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		removeFile(mergedPath)
+		return err
+	}
+	if err := os.Rename(mergedPath, upload.filePath); err != nil {
+		removeFile(mergedPath)
+		return err
+	}
+
+	if status, msg := inspectUpload(ctx, upload); status != 0 {
+		return fmt.Errorf("inspecting appended version: %s", msg)
+	}
+	if info, err := os.Stat(upload.filePath); err == nil {
+		upload.size = info.Size()
+	}
+	return nil
+}
+
+// handleRunDatasetReport runs a report against a dataset version selected by the
+// "version" query parameter, which is either "latest" (the default) or a number.
+func handleRunDatasetReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, status, msg := resolveDatasetVersion(r.PathValue("id"), r.URL.Query().Get("version"))
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	runReportFile(w, r, report.ID, report.FilePath, report.FileName)
+}
+
+func resolveDatasetVersion(datasetID, version string) (reports.Report, int, string) {
+	if version == "" || version == "latest" {
+		report, ok := reports.LatestVersion(datasetID)
+		if !ok {
+			return reports.Report{}, http.StatusNotFound, "dataset not found"
+		}
+		return report, 0, ""
+	}
+
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return reports.Report{}, http.StatusBadRequest, "invalid version"
+	}
+	report, ok := reports.GetVersion(datasetID, n)
+	if !ok {
+		return reports.Report{}, http.StatusNotFound, "dataset version not found"
+	}
+	return report, 0, ""
+}
@@ -0,0 +1,168 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+	"erp-export-analytics/api/internal/reports"
+)
+
+func uploadCSV(t *testing.T, router http.Handler, url, name, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, url, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleDatasetVersions(t *testing.T) {
+	oldDir := httpapi.UploadTempDir
+	uploadDir := t.TempDir()
+	httpapi.SetUploadTempDir(uploadDir)
+	defer func() {
+		httpapi.SetUploadTempDir(oldDir)
+		reports.ClearStore()
+	}()
+	router := httpapi.NewRouter()
+
+	rr := uploadCSV(t, router, "/api/upload", "invoices.csv", "id,status,total\n1,Paid,10\n2,Open,20\n")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rr.Code)
+	}
+	var first httpapi.UploadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.DatasetID == "" || first.Version != 1 || first.Rows != 2 {
+		t.Fatalf("unexpected first version: %+v", first)
+	}
+	versionsURL := "/api/datasets/" + first.DatasetID + "/versions"
+
+	t.Run("append with reordered columns", func(t *testing.T) {
+		rr := uploadCSV(t, router, versionsURL+"?mode=append", "march.csv", "total,id,status\n30,3,Paid\n")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp httpapi.UploadResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Version != 2 || resp.Rows != 3 {
+			t.Errorf("expected version 2 with 3 rows, got version %d with %d rows", resp.Version, resp.Rows)
+		}
+		if len(resp.PreviewRows) != 3 || resp.PreviewRows[2][0] != "3" || resp.PreviewRows[2][2] != "30" {
+			t.Errorf("expected appended row in base column order, got %v", resp.PreviewRows)
+		}
+	})
+
+	t.Run("append rejects extra columns", func(t *testing.T) {
+		rr := uploadCSV(t, router, versionsURL+"?mode=append", "bad.csv", "id,status,total,note\n4,Paid,1,x\n")
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("replace rejects missing columns", func(t *testing.T) {
+		rr := uploadCSV(t, router, versionsURL, "bad.csv", "id,status\n4,Paid\n")
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("replace allows new columns", func(t *testing.T) {
+		rr := uploadCSV(t, router, versionsURL+"?mode=replace", "april.csv", "id,status,total,note\n9,Paid,90,x\n")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("list versions", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, versionsURL, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		var resp httpapi.DatasetVersionsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		rows := []int{}
+		for _, v := range resp.Versions {
+			rows = append(rows, v.Rows)
+		}
+		if len(rows) != 3 || rows[0] != 2 || rows[1] != 3 || rows[2] != 1 {
+			t.Errorf("expected row counts [2 3 1], got %v", rows)
+		}
+	})
+
+	t.Run("run against latest and specific version", func(t *testing.T) {
+		body := []byte(`{"metrics":[{"op":"sum","field":"total"}]}`)
+		expected := map[string]string{"": "90.00", "?version=latest": "90.00", "?version=2": "60.00", "?version=1": "30.00"}
+		for query, want := range expected {
+			req := httptest.NewRequest(http.MethodPost, "/api/datasets/"+first.DatasetID+"/run"+query, bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%q: expected status 200, got %d", query, rr.Code)
+			}
+			var resp engine.ReportResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Rows[0][0] != want {
+				t.Errorf("%q: expected sum %s, got %s", query, want, resp.Rows[0][0])
+			}
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/datasets/"+first.DatasetID+"/run?version=7", bytes.NewReader([]byte(`{}`)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("unknown dataset", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/datasets/missing/versions", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("failed append leaves no files", func(t *testing.T) {
+		latest, _ := reports.LatestVersion(first.DatasetID)
+		if err := os.Remove(latest.FilePath); err != nil {
+			t.Fatal(err)
+		}
+		before, _ := os.ReadDir(uploadDir)
+		rr := uploadCSV(t, router, versionsURL+"?mode=append", "may.csv", "id,status,total,note\n10,Paid,1,y\n")
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status 500, got %d", rr.Code)
+		}
+		if after, _ := os.ReadDir(uploadDir); len(after) != len(before) {
+			t.Errorf("expected %d files in the upload directory, got %d", len(before), len(after))
+		}
+	})
+}
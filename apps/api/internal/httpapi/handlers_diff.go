@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// RowDiffRequest selects the two reports to diff and the columns identifying a row.
+type RowDiffRequest struct {
+	BaseReportID    string   `json:"baseReportId"`
+	CompareReportID string   `json:"compareReportId"`
+	KeyColumns      []string `json:"keyColumns"`
+}
+
+// rowDiffSummaryLine is the final line of a row diff stream.
+type rowDiffSummaryLine struct {
+	Type string `json:"type"`
+	engine.RowDiffSummary
+}
+
+// handleDiffRows streams the row-level differences between two reports as
+// newline-delimited JSON: one engine.RowChange per line, followed by a summary line.
+func handleDiffRows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RowDiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	basePath, ok := resolveReportPath(req.BaseReportID)
+	if !ok {
+		http.Error(w, "base report not found", http.StatusNotFound)
+		return
+	}
+	comparePath, ok := resolveReportPath(req.CompareReportID)
+	if !ok {
+		http.Error(w, "compare report not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	stream := newNDJSONStream(w)
+	summary, err := engine.DiffRows(ctx, basePath, comparePath, req.KeyColumns, func(change engine.RowChange) error {
+		return stream.write(change)
+	})
+	if err != nil {
+		log.Printf("error diffing reports: %v", err)
+		if !stream.started {
+			writeQueryError(w, err, "failed to diff reports")
+			return
+		}
+		_ = stream.write(map[string]string{"type": "error", "error": "failed to diff reports"})
+		return
+	}
+
+	if err := stream.write(rowDiffSummaryLine{Type: "summary", RowDiffSummary: summary}); err != nil {
+		log.Printf("error writing diff summary: %v", err)
+	}
+}
+
+// ndjsonStream writes newline-delimited JSON values, sending the response header
+// with the first value so that errors before any output can still use a status code.
+type ndjsonStream struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	started bool
+}
+
+func newNDJSONStream(w http.ResponseWriter) *ndjsonStream {
+	return &ndjsonStream{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *ndjsonStream) write(v any) error {
+	if !s.started {
+		s.w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package httpapi_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleDiffRows(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	t.Run("identical samples", func(t *testing.T) {
+		body := []byte(`{"baseReportId":"sample-sample-invoices","compareReportId":"sample-sample-invoices","keyColumns":["invoice_id"]}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/diff", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson; charset=utf-8" {
+			t.Errorf("unexpected content type %s", ct)
+		}
+
+		var lines []map[string]any
+		scanner := bufio.NewScanner(rr.Body)
+		for scanner.Scan() {
+			var line map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) != 1 || lines[0]["type"] != "summary" || lines[0]["unchanged"] != float64(50) {
+			t.Errorf("expected only a summary with 50 unchanged rows, got %v", lines)
+		}
+	})
+
+	t.Run("invalid key column", func(t *testing.T) {
+		body := []byte(`{"baseReportId":"sample-sample-invoices","compareReportId":"sample-sample-invoices","keyColumns":["nope"]}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/diff", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// handleDrillThrough returns the raw rows behind one group of a report, a page
+// at a time as JSON, or as a CSV download with ?format=csv.
+func handleDrillThrough(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reportID := r.PathValue("id")
+	filePath, ok := resolveReportPath(reportID)
+	if !ok {
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+
+	var req engine.DrillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !resolveJoinFiles(w, req.Joins) {
+		return
+	}
+
+	// The CSV response starts with the header row, which DrillThrough emits only
+	// once the request is valid, so errors can still set the status code.
+	var emit func(row []string) error
+	var csvWriter *csv.Writer
+	if r.URL.Query().Get("format") == FormatCSV {
+		filename := slugFileName(reportFileName(reportID), append([]string{"rows"}, req.Group...), FormatCSV)
+		emit = func(row []string) error {
+			if csvWriter == nil {
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+				w.WriteHeader(http.StatusOK)
+				csvWriter = csv.NewWriter(w)
+			}
+			return csvWriter.Write(row)
+		}
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	resp, err := engine.DrillThrough(ctx, filePath, req, emit)
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	if err != nil {
+		log.Printf("error drilling into report: %v", err)
+		if csvWriter != nil {
+			return
+		}
+		writeQueryError(w, err, "failed to drill into report")
+		return
+	}
+	if csvWriter == nil {
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,66 @@
+package httpapi_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleDrillThrough(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+	body := `{"groupBy":["currency"],"group":["GBP"],"columns":["payment_id","amount"]}`
+
+	t.Run("json page", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-payments/drill", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.DrillResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Matched != 4 || len(resp.Rows) != 4 || resp.Rows[0][0] != "PAY-2003" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("csv download", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-payments/drill?format=csv", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="sample-payments-rows-gbp.csv"` {
+			t.Errorf("unexpected Content-Disposition: %s", got)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 5 || strings.Join(records[0], ",") != "payment_id,amount" {
+			t.Errorf("unexpected csv: %v", records)
+		}
+	})
+
+	t.Run("invalid group", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-payments/drill?format=csv", strings.NewReader(`{"groupBy":["currency"]}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/jobs"
+)
+
+// handleCreateJob queues a report run and responds with the job, whose status
+// can then be polled at the Location header.
+func handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reportID := r.PathValue("id")
+	filePath, ok := resolveReportPath(reportID)
+	if !ok {
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+
+	var req engine.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !resolveRequestFiles(w, &req) {
+		return
+	}
+
+	timeout, err := queryBudget(r, JobTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := jobs.Submit(reportID, timeout, func(ctx context.Context, progress func(engine.Progress)) (engine.ReportResponse, error) {
+		return engine.RunReportWithProgress(ctx, filePath, req, progress)
+	})
+	if errors.Is(err, jobs.ErrQueueFull) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// handleJob returns the status and progress of a job on GET and cancels it on
+// DELETE.
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	var job jobs.Job
+	var ok bool
+	switch r.Method {
+	case http.MethodGet:
+		job, ok = jobs.Get(r.PathValue("id"))
+	case http.MethodDelete:
+		job, ok = jobs.Cancel(r.PathValue("id"))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleJobResult returns the report of a succeeded job. Jobs that have not
+// succeeded respond with 409 Conflict and their status.
+func handleJobResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, result, ok := jobs.Result(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if job.Status != jobs.StatusSucceeded {
+		writeJSON(w, http.StatusConflict, job)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,88 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+	"erp-export-analytics/api/internal/jobs"
+)
+
+func TestHandleJobs(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	jobs.Start(2)
+	defer jobs.ClearStore()
+	router := httpapi.NewRouter()
+
+	body := `{"groupBy":["status"],"metrics":[{"op":"count"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/jobs", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var job jobs.Job
+	if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	location := rr.Header().Get("Location")
+	if location != "/api/jobs/"+job.ID {
+		t.Errorf("unexpected Location: %s", location)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != jobs.StatusSucceeded && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, location, nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != jobs.StatusSucceeded || job.Progress.RowsScanned != 50 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, location+"/result", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var resp engine.ReportResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Rows) == 0 {
+		t.Error("expected report rows")
+	}
+
+	t.Run("cancel finished job", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, location, nil))
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), jobs.StatusSucceeded) {
+			t.Errorf("expected finished job to be left alone, got %d %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/jobs?timeout=-1s", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/jobs/missing", nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+func handleKPIs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req engine.KPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var ok bool
+	if req.InvoicesPath, ok = resolveReportPath(req.InvoicesReportID); !ok {
+		http.Error(w, "invoices report not found", http.StatusNotFound)
+		return
+	}
+	if req.PaymentsPath, ok = resolveReportPath(req.PaymentsReportID); !ok {
+		http.Error(w, "payments report not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	resp, err := engine.RunKPIs(ctx, req)
+	if err != nil {
+		log.Printf("error computing kpis: %v", err)
+		writeQueryError(w, err, "failed to compute kpis")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
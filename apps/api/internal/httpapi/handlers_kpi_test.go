@@ -0,0 +1,46 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleKPIs(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	t.Run("kpis on samples", func(t *testing.T) {
+		body := []byte(`{"invoicesReportId":"sample-sample-invoices","paymentsReportId":"sample-sample-payments","from":"2026-01-01","to":"2026-03-31"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/kpis", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.KPIResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Trend) != 3 || resp.Summary.DSO == nil || len(resp.Customers) == 0 {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	})
+
+	t.Run("invalid dates", func(t *testing.T) {
+		body := []byte(`{"invoicesReportId":"sample-sample-invoices","paymentsReportId":"sample-sample-payments","from":"soon"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/kpis", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
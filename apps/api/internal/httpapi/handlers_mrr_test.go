@@ -0,0 +1,38 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleMRR(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-subscriptions/mrr", bytes.NewReader([]byte(`{}`)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var resp engine.MRRResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Months) == 0 || len(resp.UnmappedEventTypes) != 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	for i := 1; i < len(resp.Months); i++ {
+		if resp.Months[i].Starting != resp.Months[i-1].Ending {
+			t.Errorf("month %s starts at %s but previous month ended at %s", resp.Months[i].Month, resp.Months[i].Starting, resp.Months[i-1].Ending)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// handleReconcile matches payments to invoices. With ?format=csv the exception
+// list is returned as a CSV download instead of the JSON summary.
+func handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req engine.ReconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var ok bool
+	if req.InvoicesPath, ok = resolveReportPath(req.InvoicesReportID); !ok {
+		http.Error(w, "invoices report not found", http.StatusNotFound)
+		return
+	}
+	if req.PaymentsPath, ok = resolveReportPath(req.PaymentsReportID); !ok {
+		http.Error(w, "payments report not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	resp, err := engine.Reconcile(ctx, req)
+	if err != nil {
+		log.Printf("error reconciling payments: %v", err)
+		writeQueryError(w, err, "failed to reconcile payments")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		records := make([][]string, 0, len(resp.Exceptions))
+		for _, e := range resp.Exceptions {
+			records = append(records, e.Record())
+		}
+		writeCSV(w, "reconciliation-exceptions.csv", engine.ExceptionColumns, records)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
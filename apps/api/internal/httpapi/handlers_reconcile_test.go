@@ -0,0 +1,70 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleReconcile(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+	body := []byte(`{"invoicesReportId":"sample-sample-invoices","paymentsReportId":"sample-sample-payments","fuzzyMatch":true}`)
+
+	t.Run("summary", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reconcile", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.ReconcileResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		s := resp.Summary
+		if s.Invoices != 50 || s.Payments != 80 {
+			t.Errorf("expected 50 invoices and 80 payments, got %d and %d", s.Invoices, s.Payments)
+		}
+		if s.FullyPaid+s.PartiallyPaid+s.Overpaid+s.Unpaid != s.Invoices {
+			t.Errorf("invoice statuses do not add up: %+v", s)
+		}
+	})
+
+	t.Run("csv exceptions download", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reconcile?format=csv", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="reconciliation-exceptions.csv"` {
+			t.Errorf("unexpected content disposition %s", cd)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) < 2 || records[0][0] != "type" {
+			t.Errorf("expected header and exception rows, got %v", records)
+		}
+	})
+
+	t.Run("report not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/reconcile", bytes.NewReader([]byte(`{"invoicesReportId":"missing"}`)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"erp-export-analytics/api/internal/csvutil"
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/reports"
+)
+
+// handleBrowseRows pages through the raw rows of a report. Query parameters:
+// offset and limit, or cursor; columns (comma-separated); sort and order
+// ("asc" or "desc"); and any number of filter=field:op:value.
+func handleBrowseRows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reportID := r.PathValue("id")
+	filePath, ok := resolveReportPath(reportID)
+	if !ok {
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+	var index *csvutil.RowIndex
+	if report, ok := reports.GetReport(reportID); ok {
+		index = report.RowIndex
+	}
+
+	req, err := parseRowsRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	resp, err := engine.BrowseRows(ctx, filePath, index, req)
+	if err != nil {
+		log.Printf("error browsing rows: %v", err)
+		writeQueryError(w, err, "failed to read rows")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseRowsRequest(r *http.Request) (engine.RowsRequest, error) {
+	q := r.URL.Query()
+	req := engine.RowsRequest{
+		Sort:   q.Get("sort"),
+		Cursor: q.Get("cursor"),
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		req.Desc = true
+	default:
+		return req, fmt.Errorf("invalid order: %s", q.Get("order"))
+	}
+	for _, name := range []string{"offset", "limit"} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return req, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			if name == "offset" {
+				req.Offset = n
+			} else {
+				req.Limit = n
+			}
+		}
+	}
+	if columns := q.Get("columns"); columns != "" {
+		req.Columns = strings.Split(columns, ",")
+	}
+	for _, f := range q["filter"] {
+		parts := strings.SplitN(f, ":", 3)
+		if len(parts) != 3 {
+			return req, fmt.Errorf("invalid filter: %s", f)
+		}
+		req.Filters = append(req.Filters, engine.Filter{Field: parts[0], Op: parts[1], Value: parts[2]})
+	}
+	return req, nil
+}
@@ -0,0 +1,85 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+	"erp-export-analytics/api/internal/reports"
+)
+
+func TestHandleBrowseRows(t *testing.T) {
+	oldDir := httpapi.UploadTempDir
+	httpapi.SetUploadTempDir(t.TempDir())
+	defer func() {
+		httpapi.SetUploadTempDir(oldDir)
+		reports.ClearStore()
+	}()
+	router := httpapi.NewRouter()
+
+	var sb strings.Builder
+	sb.WriteString("id,status,total\n")
+	for i := 1; i <= 2500; i++ {
+		status := "Paid"
+		if i%10 == 0 {
+			status = "Open"
+		}
+		fmt.Fprintf(&sb, "%d,%s,%d\n", i, status, i)
+	}
+	rr := uploadCSV(t, router, "/api/upload", "invoices.csv", sb.String())
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rr.Code)
+	}
+	var upload httpapi.UploadResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &upload); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, query string) (*httptest.ResponseRecorder, engine.RowsResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/reports/"+upload.ReportID+"/rows?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp engine.RowsResponse
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rr, resp
+	}
+
+	t.Run("deep page", func(t *testing.T) {
+		rr, resp := get(t, "offset=2100&limit=2&columns=id")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if len(resp.Rows) != 2 || resp.Rows[0][0] != "2101" {
+			t.Errorf("unexpected rows: %v", resp.Rows)
+		}
+		if resp.RowsScanned > 200 {
+			t.Errorf("expected the row index to skip most rows, scanned %d", resp.RowsScanned)
+		}
+	})
+
+	t.Run("filter and sort", func(t *testing.T) {
+		rr, resp := get(t, "filter=status:eq:Open&sort=total&order=desc&limit=3")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if len(resp.Rows) != 3 || resp.Rows[0][0] != "2500" || resp.Rows[2][0] != "2480" {
+			t.Errorf("unexpected rows: %v", resp.Rows)
+		}
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		if rr, _ := get(t, "filter=status"); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
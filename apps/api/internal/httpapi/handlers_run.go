@@ -9,6 +9,7 @@ import (
 
 	"erp-export-analytics/api/internal/engine"
 	"erp-export-analytics/api/internal/reports"
+	"erp-export-analytics/api/internal/resultcache"
 )
 
 func handleRunReport(w http.ResponseWriter, r *http.Request) {
@@ -24,25 +25,56 @@ func handleRunReport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	report, ok := reports.GetReport(reportID)
-
-	var filePath string
+	filePath, ok := resolveReportPath(reportID)
 	if !ok {
-		// Check if it's a sample report
-		if strings.HasPrefix(reportID, "sample-") {
-			sampleID := strings.TrimPrefix(reportID, "sample-")
-			sample, ok := SampleFiles[sampleID]
-			if !ok {
-				http.Error(w, "report not found", http.StatusNotFound)
-				return
-			}
-			filePath = filepath.Join(DataDir, "samples", sample.FileName)
-		} else {
-			http.Error(w, "report not found", http.StatusNotFound)
-			return
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+
+	runReportFile(w, r, reportID, filePath, reportFileName(reportID))
+}
+
+// resolveReportPath returns the CSV file backing an uploaded report or a
+// "sample-" prefixed sample dataset.
+func resolveReportPath(reportID string) (string, bool) {
+	if report, ok := reports.GetReport(reportID); ok {
+		return report.FilePath, true
+	}
+
+	// Check if it's a sample report
+	if strings.HasPrefix(reportID, "sample-") {
+		sampleID := strings.TrimPrefix(reportID, "sample-")
+		sample, ok := SampleFiles[sampleID]
+		if !ok {
+			return "", false
 		}
-	} else {
-		filePath = report.FilePath
+		return filepath.Join(DataDir, "samples", sample.FileName), true
+	}
+	return "", false
+}
+
+// reportFileName returns the original file name of an uploaded or sample report.
+func reportFileName(reportID string) string {
+	if report, ok := reports.GetReport(reportID); ok {
+		return report.FileName
+	}
+	if sample, ok := SampleFiles[strings.TrimPrefix(reportID, "sample-")]; ok {
+		return sample.FileName
+	}
+	return ""
+}
+
+// runReportFile decodes a ReportRequest from the body and runs it against
+// filePath, the file of reportID. Results are cached per report and request;
+// the X-Cache response header tells whether the result came from the cache,
+// and a "Cache-Control: no-cache" request header skips it. The format query
+// parameter or the Accept header turns the result into a CSV, XLSX or JSON
+// download named after datasetName.
+func runReportFile(w http.ResponseWriter, r *http.Request, reportID, filePath, datasetName string) {
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	var req engine.ReportRequest
@@ -50,19 +82,69 @@ func handleRunReport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !resolveRequestFiles(w, &req) {
+		return
+	}
 
-	resp, err := engine.RunReport(filePath, req)
+	ctx, cancel, err := queryContext(r)
 	if err != nil {
-		log.Printf("error running report: %v", err)
-		// Distinguish between client error and server error?
-		// For now, simple approach
-		if strings.Contains(err.Error(), "invalid") {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(w, "failed to run report", http.StatusInternalServerError)
-		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	defer cancel()
+
+	gen := resultcache.Generation()
+	resp, hit := engine.ReportResponse{}, false
+	if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		resp, hit = resultcache.Get(reportID, req)
+	}
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		if resp, err = engine.RunReport(ctx, filePath, req); err != nil {
+			log.Printf("error running report: %v", err)
+			writeQueryError(w, err, "failed to run report")
+			return
+		}
+		resultcache.Put(reportID, req, resp, gen)
+		w.Header().Set("X-Cache", "MISS")
+	}
 
+	if format != "" {
+		writeReportExport(w, format, exportFileName(datasetName, req, format), req, resp)
+		return
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
+
+// resolveRequestFiles fills in the file paths of the joined reports and FX rate
+// table referenced by req. It writes a 404 response and returns false when one
+// of them does not exist.
+func resolveRequestFiles(w http.ResponseWriter, req *engine.ReportRequest) bool {
+	if !resolveJoinFiles(w, req.Joins) {
+		return false
+	}
+	if req.Currency != nil {
+		path, ok := resolveReportPath(req.Currency.FXReportID)
+		if !ok {
+			http.Error(w, "fx rate table not found: "+req.Currency.FXReportID, http.StatusNotFound)
+			return false
+		}
+		req.Currency.FXPath = path
+	}
+	return true
+}
+
+// resolveJoinFiles fills in the file paths of the joined reports. It writes a
+// 404 response and returns false when one of them does not exist.
+func resolveJoinFiles(w http.ResponseWriter, joins []engine.Join) bool {
+	for i, j := range joins {
+		path, ok := resolveReportPath(j.ReportID)
+		if !ok {
+			http.Error(w, "joined report not found: "+j.ReportID, http.StatusNotFound)
+			return false
+		}
+		joins[i].FilePath = path
+	}
+	return true
+}
@@ -6,10 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"erp-export-analytics/api/internal/engine"
 	"erp-export-analytics/api/internal/httpapi"
+	"erp-export-analytics/api/internal/reports"
 )
 
 func TestHandleRunReport(t *testing.T) {
@@ -51,6 +53,158 @@ func TestHandleRunReport(t *testing.T) {
 		}
 	})
 
+	t.Run("join samples", func(t *testing.T) {
+		reqBody := map[string]any{
+			"groupBy": []string{"inv.country"},
+			"metrics": []map[string]any{{"op": "sum", "field": "amount"}},
+			"joins": []map[string]any{{
+				"reportId": "sample-sample-invoices",
+				"type":     "inner",
+				"prefix":   "inv.",
+				"on":       []map[string]string{{"left": "invoice_id", "right": "invoice_id"}},
+			}},
+		}
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-payments/run", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.ReportResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Columns) != 2 || resp.Columns[0] != "inv.country" {
+			t.Errorf("unexpected columns: %v", resp.Columns)
+		}
+		if len(resp.Rows) == 0 {
+			t.Error("expected non-empty rows")
+		}
+	})
+
+	t.Run("joined report not found", func(t *testing.T) {
+		body := []byte(`{"metrics":[{"op":"count"}],"joins":[{"reportId":"missing","type":"inner","on":[{"left":"invoice_id","right":"invoice_id"}]}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-payments/run", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("convert currency with uploaded fx table", func(t *testing.T) {
+		oldDir := httpapi.UploadTempDir
+		httpapi.SetUploadTempDir(t.TempDir())
+		defer func() {
+			httpapi.SetUploadTempDir(oldDir)
+			reports.ClearStore()
+		}()
+
+		rr := uploadCSV(t, router, "/api/upload", "fx.csv", "date,from,to,rate\n2026-01-01,EUR,USD,1.10\n2026-01-01,GBP,USD,1.25\n")
+		var upload httpapi.UploadResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &upload); err != nil {
+			t.Fatal(err)
+		}
+
+		reqBody := map[string]any{
+			"metrics": []map[string]any{{"op": "sum", "field": "total"}},
+			"currency": map[string]any{
+				"fxReportId": upload.ReportID,
+				"target":     "USD",
+				"dateField":  "invoice_date",
+			},
+		}
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run", bytes.NewReader(body))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.ReportResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Currency != "USD" || len(resp.MissingRates) != 0 {
+			t.Errorf("expected full conversion to USD, got %s with missing %+v", resp.Currency, resp.MissingRates)
+		}
+	})
+
+	t.Run("fx table not found", func(t *testing.T) {
+		body := []byte(`{"metrics":[{"op":"sum","field":"total"}],"currency":{"fxReportId":"missing","target":"USD"}}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		body := []byte(`{"metrics":[{"op":"count"}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run?timeout=soon", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("too many groups", func(t *testing.T) {
+		defer func(budget int64) { engine.GroupMemoryBudget = budget }(engine.GroupMemoryBudget)
+		engine.GroupMemoryBudget = 1
+
+		body := []byte(`{"groupBy":["invoice_id"],"metrics":[{"op":"count"}]}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run", bytes.NewReader(body))
+		req.Header.Set("Cache-Control", "no-cache")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "too many groups") {
+			t.Errorf("expected status 422 with too many groups, got %d %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("approximate", func(t *testing.T) {
+		body := []byte(`{"metrics":[{"op":"count_distinct","field":"customer_name"},{"op":"median","field":"total"}],"approximate":true}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d %s", rr.Code, rr.Body.String())
+		}
+		var resp engine.ReportResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.Approximation == nil || resp.Approximation.SampleSize != resp.RowsScanned {
+			t.Errorf("expected the sample size of an unsampled report, got %+v", resp.Approximation)
+		}
+
+		body = []byte(`{"metrics":[{"op":"count"}],"sampleRate":0.5}`)
+		req = httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/run", bytes.NewReader(body))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for sampling without approximate, got %d", rr.Code)
+		}
+	})
+
 	t.Run("report not found", func(t *testing.T) {
 		reqBody := map[string]any{
 			"groupBy": []string{},
@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// Server-sent event names of a streamed report run.
+const (
+	eventProgress = "progress"
+	eventResult   = "result"
+	eventError    = "error"
+)
+
+// ProgressEvent is the data of a progress event. Partial holds the top rows
+// found so far when the report is sorted.
+type ProgressEvent struct {
+	engine.Progress
+	Percent   float64 `json:"percent"`
+	ElapsedMs int64   `json:"elapsedMs"`
+}
+
+// handleStreamReport runs a report and streams its progress as server-sent
+// events. Progress events are sent every engine.ProgressInterval rows, and the
+// final event is either the ReportResponse ("result") or an "error". Errors
+// found before the scan starts are plain HTTP errors.
+func handleStreamReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filePath, ok := resolveReportPath(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "report not found", http.StatusNotFound)
+		return
+	}
+
+	var req engine.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !resolveRequestFiles(w, &req) {
+		return
+	}
+
+	ctx, cancel, err := queryContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	start := time.Now()
+	stream := newSSEStream(w)
+	resp, err := engine.RunReportWithProgress(ctx, filePath, req, func(p engine.Progress) {
+		event := ProgressEvent{Progress: p, Percent: p.Percent(), ElapsedMs: time.Since(start).Milliseconds()}
+		if err := stream.send(eventProgress, event); err != nil {
+			log.Printf("error streaming report progress: %v", err)
+			cancel()
+		}
+	})
+	if err != nil {
+		log.Printf("error running report: %v", err)
+		if !stream.started {
+			writeQueryError(w, err, "failed to run report")
+			return
+		}
+		_ = stream.send(eventError, map[string]string{"error": queryErrorMessage(err, "failed to run report")})
+		return
+	}
+
+	if err := stream.send(eventResult, resp); err != nil {
+		log.Printf("error streaming report result: %v", err)
+	}
+}
+
+// sseStream writes server-sent events, sending the response header with the
+// first event so that errors before any output can still use a status code.
+type sseStream struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func newSSEStream(w http.ResponseWriter) *sseStream {
+	return &sseStream{w: w}
+}
+
+func (s *sseStream) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !s.started {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/httpapi"
+)
+
+func TestHandleStreamReport(t *testing.T) {
+	httpapi.DataDir = filepath.Join("..", "..", "data")
+	router := httpapi.NewRouter()
+
+	t.Run("streams progress then the result", func(t *testing.T) {
+		body := `{"groupBy":["status"],"metrics":[{"op":"count"}],"sort":"count","desc":true,"limit":2}`
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/stream", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("unexpected content type: %s", ct)
+		}
+
+		events := strings.Split(strings.TrimSpace(rr.Body.String()), "\n\n")
+		if len(events) != 2 {
+			t.Fatalf("expected a progress and a result event, got %q", events)
+		}
+		var progress httpapi.ProgressEvent
+		if err := json.Unmarshal([]byte(eventData(t, events[0], "progress")), &progress); err != nil {
+			t.Fatal(err)
+		}
+		if progress.RowsScanned != 50 || progress.Groups == 0 || progress.Percent != 100 {
+			t.Errorf("unexpected progress: %+v", progress)
+		}
+		if progress.Partial == nil || len(progress.Partial.Rows) != 2 {
+			t.Fatalf("expected partial top 2 rows, got %+v", progress.Partial)
+		}
+
+		var resp engine.ReportResponse
+		if err := json.Unmarshal([]byte(eventData(t, events[1], "result")), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Rows) != 2 || resp.Rows[0][0] != progress.Partial.Rows[0][0] {
+			t.Errorf("unexpected result: %v", resp.Rows)
+		}
+	})
+
+	t.Run("invalid sort column", func(t *testing.T) {
+		body := `{"groupBy":["status"],"metrics":[{"op":"count"}],"sort":"missing"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/reports/sample-sample-invoices/stream", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
+
+// eventData returns the data of a server-sent event after checking its name.
+func eventData(t *testing.T, event, name string) string {
+	t.Helper()
+	lines := strings.Split(event, "\n")
+	if len(lines) != 2 || lines[0] != "event: "+name || !strings.HasPrefix(lines[1], "data: ") {
+		t.Fatalf("unexpected %s event: %q", name, event)
+	}
+	return strings.TrimPrefix(lines[1], "data: ")
+}
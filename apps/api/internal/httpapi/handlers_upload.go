@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -8,9 +9,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"erp-export-analytics/api/internal/csvutil"
+	"erp-export-analytics/api/internal/engine"
 	"erp-export-analytics/api/internal/reports"
 	"github.com/google/uuid"
 )
@@ -25,24 +28,88 @@ func SetUploadTempDir(dir string) {
 	UploadTempDir = dir
 }
 
+// savedUpload describes a CSV file received from a multipart form and written to UploadTempDir.
+type savedUpload struct {
+	reportID    string
+	fileName    string
+	filePath    string
+	size        int64
+	columns     []string
+	previewRows [][]string
+	rows        int
+	index       csvutil.RowIndex
+	cachePath   string
+}
+
 func handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	upload, ok := receiveUpload(w, r)
+	if !ok {
+		return
+	}
+
+	cacheUpload(r.Context(), &upload)
+
+	// Register report for future use and cleanup
+	report := reports.AddVersion(reports.Report{
+		ID:        upload.reportID,
+		FilePath:  upload.filePath,
+		CreatedAt: time.Now(),
+		DatasetID: uuid.NewString(),
+		FileName:  upload.fileName,
+		Columns:   upload.columns,
+		Rows:      upload.rows,
+		RowIndex:  &upload.index,
+	})
+
+	writeJSON(w, http.StatusCreated, newUploadResponse(report, upload))
+}
+
+// cacheUpload builds the column cache that reports on the upload read instead
+// of the CSV. A failure only costs speed, so it is logged and the upload kept.
+func cacheUpload(ctx context.Context, upload *savedUpload) {
+	if err := engine.BuildColumnCache(ctx, upload.filePath); err != nil {
+		log.Printf("error building column cache for %s: %v", upload.filePath, err)
+		return
+	}
+	upload.cachePath = engine.ColumnCachePath(upload.filePath)
+}
+
+var cacheCleanupOnce sync.Once
+
+// StartColumnCacheCleanup removes the column cache of every report removed from
+// the store, both its file and its decoded copy in memory. It is safe to call
+// more than once; only the first call has an effect.
+func StartColumnCacheCleanup() {
+	cacheCleanupOnce.Do(func() {
+		reports.OnRemove(func(r reports.Report) {
+			if err := engine.RemoveColumnCache(r.FilePath); err != nil {
+				log.Printf("error removing column cache of %s: %v", r.FilePath, err)
+			}
+		})
+	})
+}
+
+// receiveUpload reads the "file" form field, stores it in UploadTempDir and parses
+// its header and preview rows. On failure it writes the error response itself and
+// returns false.
+func receiveUpload(w http.ResponseWriter, r *http.Request) (savedUpload, bool) {
 	// Limit upload size
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
 	err := r.ParseMultipartForm(maxUploadBytes)
 	if err != nil {
 		http.Error(w, "file too large or invalid multipart form", http.StatusBadRequest)
-		return
+		return savedUpload{}, false
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "failed to get file from form-data", http.StatusBadRequest)
-		return
+		return savedUpload{}, false
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
@@ -55,65 +122,114 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	ext := strings.ToLower(filepath.Ext(filename))
 	if ext != ".csv" {
 		http.Error(w, "only .csv files are allowed", http.StatusUnsupportedMediaType)
-		return
+		return savedUpload{}, false
 	}
 
 	reportID := uuid.NewString()
-	tempFileName := fmt.Sprintf("%s-%s", reportID, filename)
-	tempFilePath := filepath.Join(UploadTempDir, tempFileName)
-
-	dst, err := os.Create(tempFilePath)
-	if err != nil {
-		http.Error(w, "failed to create temporary file", http.StatusInternalServerError)
-		return
-	}
-	defer func() {
-		if err := dst.Close(); err != nil {
-			log.Printf("error closing temporary file: %v", err)
-		}
-	}()
+	tempFilePath := newTempFilePath(reportID, filename)
 
-	size, err := io.Copy(dst, file)
+	size, err := saveFile(tempFilePath, file)
 	if err != nil {
+		log.Printf("error saving upload: %v", err)
 		http.Error(w, "failed to save file", http.StatusInternalServerError)
-		return
+		return savedUpload{}, false
 	}
 
-	if err := dst.Sync(); err != nil {
-		http.Error(w, "failed to sync file", http.StatusInternalServerError)
-		return
+	upload := savedUpload{
+		reportID: reportID,
+		fileName: filename,
+		filePath: tempFilePath,
+		size:     size,
 	}
+	if status, msg := inspectUpload(r.Context(), &upload); status != 0 {
+		removeFile(tempFilePath)
+		http.Error(w, msg, status)
+		return savedUpload{}, false
+	}
+	return upload, true
+}
 
-	// Register report for future use and cleanup
-	reports.SaveReport(reports.Report{
-		ID:        reportID,
-		FilePath:  tempFilePath,
-		CreatedAt: time.Now(),
-	})
-
+// inspectUpload fills in the header, preview rows, row count and row index of a
+// saved upload.
+// It returns a non-zero HTTP status and message when the file is not valid CSV.
+func inspectUpload(ctx context.Context, upload *savedUpload) (int, string) {
 	// Open the saved temp file for CSV parsing
-	f, err := os.Open(tempFilePath)
+	f, err := os.Open(upload.filePath)
 	if err != nil {
-		http.Error(w, "failed to open temporary file for reading", http.StatusInternalServerError)
-		return
+		return http.StatusInternalServerError, "failed to open temporary file for reading"
 	}
 	defer f.Close()
 
 	headers, previewRows, err := csvutil.ParseCSV(f)
 	if err == io.EOF {
-		http.Error(w, "csv file is empty", http.StatusBadRequest)
-		return
+		return http.StatusBadRequest, "csv file is empty"
 	}
 	if err != nil {
-		http.Error(w, "failed to parse csv", http.StatusBadRequest)
-		return
+		return http.StatusBadRequest, "failed to parse csv"
 	}
 
-	writeJSON(w, http.StatusCreated, UploadResponse{
-		ReportID:    reportID,
-		FileName:    filename,
-		Size:        size,
-		Columns:     headers,
-		PreviewRows: previewRows,
-	})
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return http.StatusInternalServerError, "failed to read temporary file"
+	}
+	rows, index, err := csvutil.IndexRows(ctx, f, csvutil.DefaultIndexStride)
+	if ctx.Err() != nil {
+		return statusClientClosedRequest, "upload cancelled"
+	}
+	if err != nil {
+		return http.StatusBadRequest, "failed to parse csv"
+	}
+
+	upload.columns = headers
+	upload.previewRows = previewRows
+	upload.rows = rows
+	upload.index = index
+	return 0, ""
+}
+
+func newTempFilePath(reportID, filename string) string {
+	return filepath.Join(UploadTempDir, fmt.Sprintf("%s-%s", reportID, filename))
+}
+
+// saveFile copies src into a newly created file at path and syncs it to disk.
+func saveFile(path string, src io.Reader) (int64, error) {
+	dst, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		if err := dst.Close(); err != nil {
+			log.Printf("error closing temporary file: %v", err)
+		}
+	}()
+
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		removeFile(path)
+		return 0, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	if err := dst.Sync(); err != nil {
+		removeFile(path)
+		return 0, fmt.Errorf("failed to sync file: %w", err)
+	}
+	return size, nil
+}
+
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("error removing temporary file %s: %v", path, err)
+	}
+}
+
+func newUploadResponse(report reports.Report, upload savedUpload) UploadResponse {
+	return UploadResponse{
+		ReportID:    report.ID,
+		DatasetID:   report.DatasetID,
+		Version:     report.Version,
+		FileName:    report.FileName,
+		Size:        upload.size,
+		Rows:        report.Rows,
+		Columns:     report.Columns,
+		PreviewRows: upload.previewRows,
+	}
 }
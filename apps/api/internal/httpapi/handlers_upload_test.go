@@ -16,6 +16,7 @@ import (
 
 func TestHandleUpload(t *testing.T) {
 	router := httpapi.NewRouter()
+	httpapi.StartColumnCacheCleanup()
 
 	t.Run("successful upload", func(t *testing.T) {
 		body := &bytes.Buffer{}
@@ -181,13 +182,13 @@ func TestHandleUpload(t *testing.T) {
 			t.Errorf("expected status 201, got %d", rr.Code)
 		}
 
-		// Check if the file exists (it should because it's not deleted immediately)
+		// Check if the file and its column cache exist (they should because they're not deleted immediately)
 		entries, err := os.ReadDir(tmpDir)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if len(entries) != 1 {
-			t.Errorf("expected temp directory to have 1 file, but found %d files", len(entries))
+		if len(entries) != 2 {
+			t.Errorf("expected temp directory to have 2 files, but found %d files", len(entries))
 		}
 
 		// Run manual cleanup
@@ -0,0 +1,93 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"erp-export-analytics/api/internal/engine"
+)
+
+// QueryTimeout is the time budget of a query run by an HTTP request. A request
+// can shorten it with the timeout query parameter, e.g. "?timeout=30s". Zero
+// means no budget.
+var QueryTimeout = 2 * time.Minute
+
+// JobTimeout is the time budget of an asynchronous report job, counted from
+// when a worker starts it. A request can shorten it with the timeout query
+// parameter too. Zero means no budget.
+var JobTimeout = 30 * time.Minute
+
+// statusClientClosedRequest is logged for queries whose client went away.
+const statusClientClosedRequest = 499
+
+// queryContext returns the context for the engine call of r. It is cancelled
+// when the client disconnects and expires after the query's time budget.
+func queryContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	budget, err := queryBudget(r, QueryTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if budget == 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	return ctx, cancel, nil
+}
+
+// queryBudget returns the time budget of r: the timeout query parameter when it
+// is shorter than limit, otherwise limit. Zero means no budget.
+func queryBudget(r *http.Request, limit time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get("timeout")
+	if v == "" {
+		return limit, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout: %s", v)
+	}
+	if limit == 0 || d < limit {
+		return d, nil
+	}
+	return limit, nil
+}
+
+// writeQueryError maps an engine error to a response: 504 when the query ran
+// out of time, 499 when the client went away, 422 when the report has too many
+// groups, 400 for invalid requests and 500 with msg otherwise.
+func writeQueryError(w http.ResponseWriter, err error, msg string) {
+	http.Error(w, queryErrorMessage(err, msg), queryErrorStatus(err))
+}
+
+func queryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, engine.ErrTooManyGroups):
+		return http.StatusUnprocessableEntity
+	case strings.Contains(err.Error(), "invalid"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// queryErrorMessage returns the message shown to the client for an engine error.
+func queryErrorMessage(err error, msg string) string {
+	switch queryErrorStatus(err) {
+	case http.StatusGatewayTimeout:
+		return "query timed out"
+	case statusClientClosedRequest:
+		return "query cancelled"
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return err.Error()
+	default:
+		return msg
+	}
+}
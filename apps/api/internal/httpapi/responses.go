@@ -1,9 +1,12 @@
 package httpapi
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 )
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
@@ -14,11 +17,46 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 	}
 }
 
+// writeCSV sends header and records as a CSV attachment named filename.
+func writeCSV(w http.ResponseWriter, filename string, header []string, records [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(header); err != nil {
+		log.Printf("Error writing CSV: %v", err)
+		return
+	}
+	if err := csvWriter.WriteAll(records); err != nil {
+		log.Printf("Error writing CSV: %v", err)
+	}
+}
+
 // UploadResponse defines the JSON structure for a successful CSV upload response.
 type UploadResponse struct {
 	ReportID    string     `json:"reportId"`
+	DatasetID   string     `json:"datasetId,omitempty"`
+	Version     int        `json:"version,omitempty"`
 	FileName    string     `json:"fileName"`
 	Size        int64      `json:"size"`
+	Rows        int        `json:"rows,omitempty"`
 	Columns     []string   `json:"columns"`
 	PreviewRows [][]string `json:"previewRows"`
 }
+
+// DatasetVersion describes one stored version of a dataset.
+type DatasetVersion struct {
+	ReportID  string    `json:"reportId"`
+	Version   int       `json:"version"`
+	FileName  string    `json:"fileName"`
+	Rows      int       `json:"rows"`
+	Columns   []string  `json:"columns"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DatasetVersionsResponse lists the versions of a dataset, oldest first.
+type DatasetVersionsResponse struct {
+	DatasetID string           `json:"datasetId"`
+	Versions  []DatasetVersion `json:"versions"`
+}
@@ -10,6 +10,22 @@ func NewRouter() http.Handler {
 	mux.HandleFunc("/api/samples", handleGetSamples)
 	mux.HandleFunc("/api/samples/", handleDownloadSample)
 	mux.HandleFunc("/api/reports/", handleRunReport)
+	mux.HandleFunc("/api/reports/compare", handleCompareReports)
+	mux.HandleFunc("/api/reports/diff", handleDiffRows)
+	mux.HandleFunc("/api/reports/{id}/aging", handleAging)
+	mux.HandleFunc("/api/reports/{id}/mrr", handleMRR)
+	mux.HandleFunc("/api/reports/{id}/cohorts", handleCohorts)
+	mux.HandleFunc("/api/reports/{id}/drill", handleDrillThrough)
+	mux.HandleFunc("/api/reports/{id}/rows", handleBrowseRows)
+	mux.HandleFunc("/api/reports/{id}/jobs", handleCreateJob)
+	mux.HandleFunc("/api/reports/{id}/stream", handleStreamReport)
+	mux.HandleFunc("/api/jobs/{id}", handleJob)
+	mux.HandleFunc("/api/jobs/{id}/result", handleJobResult)
+	mux.HandleFunc("/api/reconcile", handleReconcile)
+	mux.HandleFunc("/api/kpis", handleKPIs)
+	mux.HandleFunc("/api/datasets/{id}/versions", handleDatasetVersions)
+	mux.HandleFunc("/api/datasets/{id}/run", handleRunDatasetReport)
+	mux.HandleFunc("/api/cache/stats", handleCacheStats)
 	mux.HandleFunc("/health", handleHealth)
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,4 @@
+// Package jobs runs reports asynchronously on a bounded pool of workers.
+// It tracks the status and progress of each job, supports cancellation, and
+// keeps results only as long as the report they were computed from.
+package jobs
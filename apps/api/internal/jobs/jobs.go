@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/reports"
+)
+
+// Job statuses.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// ErrQueueFull is returned by Submit when every worker is busy and the queue
+// has no room left.
+var ErrQueueFull = errors.New("job queue is full")
+
+// RunFunc computes the result of a job, reporting progress as it goes.
+type RunFunc func(ctx context.Context, progress func(engine.Progress)) (engine.ReportResponse, error)
+
+// Job is a snapshot of an asynchronous report run.
+type Job struct {
+	ID         string          `json:"id"`
+	ReportID   string          `json:"reportId"`
+	Status     string          `json:"status"`
+	Progress   engine.Progress `json:"progress"`
+	Percent    float64         `json:"percent"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// entry is the mutable state behind a Job.
+type entry struct {
+	job     Job
+	run     RunFunc
+	timeout time.Duration
+	ctx     context.Context
+	cancel  context.CancelFunc
+	result  engine.ReportResponse
+}
+
+var (
+	// store holds every job by ID until it is removed.
+	store = make(map[string]*entry)
+	// mu protects store and the entries in it.
+	mu sync.Mutex
+	// QueueSize is the number of jobs that can wait for a worker.
+	QueueSize = 100
+
+	queue     chan *entry
+	startOnce sync.Once
+)
+
+// Start launches workers goroutines that run submitted jobs and ties job
+// retention to the lifetime of their reports. It is safe to call more than
+// once; only the first call has an effect.
+func Start(workers int) {
+	startOnce.Do(func() {
+		queue = make(chan *entry, QueueSize)
+		for range max(workers, 1) {
+			go work()
+		}
+		reports.OnRemove(func(r reports.Report) { RemoveReportJobs(r.ID) })
+		go func() {
+			for range time.Tick(10 * time.Minute) {
+				CleanupExpiredJobs()
+			}
+		}()
+	})
+}
+
+// Submit queues run as a new job for reportID and returns its snapshot. Once a
+// worker starts the job, run's context expires after timeout, and the job fails
+// with the error run returns then. Zero means no time limit.
+func Submit(reportID string, timeout time.Duration, run RunFunc) (Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		job:     Job{ID: uuid.NewString(), ReportID: reportID, Status: StatusQueued, CreatedAt: time.Now()},
+		run:     run,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case queue <- e:
+	default:
+		cancel()
+		return Job{}, ErrQueueFull
+	}
+	store[e.job.ID] = e
+	return e.job, nil
+}
+
+// Get returns the snapshot of a job.
+func Get(id string) (Job, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	e, ok := store[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// Result returns the job snapshot and, when it succeeded, its report.
+func Result(id string) (Job, engine.ReportResponse, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	e, ok := store[id]
+	if !ok {
+		return Job{}, engine.ReportResponse{}, false
+	}
+	return e.job, e.result, true
+}
+
+// Cancel stops a queued or running job. Finished jobs are left untouched.
+func Cancel(id string) (Job, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	e, ok := store[id]
+	if !ok {
+		return Job{}, false
+	}
+	if e.job.Status == StatusQueued || e.job.Status == StatusRunning {
+		e.cancel()
+		finish(e, StatusCancelled, "")
+	}
+	return e.job, true
+}
+
+// RemoveReportJobs cancels and forgets every job of a report.
+func RemoveReportJobs(reportID string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for id, e := range store {
+		if e.job.ReportID == reportID {
+			e.cancel()
+			delete(store, id)
+		}
+	}
+}
+
+// CleanupExpiredJobs forgets finished jobs older than the report TTL, which
+// covers jobs on sample reports that are never removed.
+func CleanupExpiredJobs() {
+	reports.StoreMu.RLock()
+	ttl := reports.TTL
+	reports.StoreMu.RUnlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	for id, e := range store {
+		if e.job.FinishedAt != nil && now.Sub(*e.job.FinishedAt) > ttl {
+			delete(store, id)
+		}
+	}
+}
+
+// ClearStore cancels and removes all jobs.
+func ClearStore() {
+	mu.Lock()
+	defer mu.Unlock()
+	for id, e := range store {
+		e.cancel()
+		delete(store, id)
+	}
+}
+
+func work() {
+	for e := range queue {
+		mu.Lock()
+		if e.job.Status != StatusQueued {
+			mu.Unlock()
+			continue
+		}
+		now := time.Now()
+		e.job.Status = StatusRunning
+		e.job.StartedAt = &now
+		mu.Unlock()
+
+		ctx, cancel := e.ctx, context.CancelFunc(func() {})
+		if e.timeout > 0 {
+			ctx, cancel = context.WithTimeout(e.ctx, e.timeout)
+		}
+		result, err := e.run(ctx, func(p engine.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			e.job.Progress = p
+			e.job.Percent = p.Percent()
+		})
+		cancel()
+
+		mu.Lock()
+		switch {
+		case e.job.Status != StatusRunning:
+			// Cancelled while running.
+		case err != nil:
+			finish(e, StatusFailed, err.Error())
+		default:
+			e.result = result
+			finish(e, StatusSucceeded, "")
+		}
+		mu.Unlock()
+		e.cancel()
+	}
+}
+
+// finish records the final status of a job. The caller holds mu.
+func finish(e *entry, status, errMsg string) {
+	now := time.Now()
+	e.job.Status = status
+	e.job.Error = errMsg
+	e.job.FinishedAt = &now
+	if status == StatusSucceeded {
+		e.job.Percent = 100
+	}
+}
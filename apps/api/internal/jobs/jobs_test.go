@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/reports"
+)
+
+// waitFor polls a job until it reaches one of the final statuses.
+func waitFor(t *testing.T, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobs(t *testing.T) {
+	Start(2)
+	defer ClearStore()
+
+	t.Run("succeeds with progress", func(t *testing.T) {
+		job, err := Submit("report-1", 0, func(ctx context.Context, progress func(engine.Progress)) (engine.ReportResponse, error) {
+			progress(engine.Progress{RowsScanned: 10, BytesRead: 50, TotalBytes: 100})
+			return engine.ReportResponse{RowsScanned: 10}, nil
+		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		job = waitFor(t, job.ID)
+		if job.Status != StatusSucceeded || job.Progress.RowsScanned != 10 || job.Percent != 100 {
+			t.Errorf("unexpected job: %+v", job)
+		}
+		if _, result, _ := Result(job.ID); result.RowsScanned != 10 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("cancel running job", func(t *testing.T) {
+		started := make(chan struct{})
+		job, err := Submit("report-1", 0, func(ctx context.Context, progress func(engine.Progress)) (engine.ReportResponse, error) {
+			close(started)
+			<-ctx.Done()
+			return engine.ReportResponse{}, ctx.Err()
+		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		<-started
+		if job, _ = Cancel(job.ID); job.Status != StatusCancelled {
+			t.Errorf("expected cancelled job, got %+v", job)
+		}
+		if job = waitFor(t, job.ID); job.Status != StatusCancelled || job.Error != "" {
+			t.Errorf("expected job to stay cancelled, got %+v", job)
+		}
+	})
+
+	t.Run("fails at its deadline", func(t *testing.T) {
+		job, err := Submit("report-1", 20*time.Millisecond, func(ctx context.Context, progress func(engine.Progress)) (engine.ReportResponse, error) {
+			<-ctx.Done()
+			return engine.ReportResponse{}, engine.ErrTimeout
+		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if job = waitFor(t, job.ID); job.Status != StatusFailed || job.Error != engine.ErrTimeout.Error() {
+			t.Errorf("expected job to fail with a timeout, got %+v", job)
+		}
+	})
+
+	t.Run("removed with its report", func(t *testing.T) {
+		reports.ClearStore()
+		reports.SaveReport(reports.Report{ID: "report-2", CreatedAt: time.Now()})
+		job, err := Submit("report-2", 0, func(ctx context.Context, progress func(engine.Progress)) (engine.ReportResponse, error) {
+			return engine.ReportResponse{}, nil
+		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		waitFor(t, job.ID)
+
+		reports.ClearStore()
+		if _, ok := Get(job.ID); ok {
+			t.Errorf("expected job of removed report to be forgotten")
+		}
+	})
+}
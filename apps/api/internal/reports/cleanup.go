@@ -3,6 +3,8 @@ package reports
 import (
 	"log"
 	"os"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -22,8 +24,7 @@ func StartCleanupWorker() {
 // deletes their corresponding files from disk, and removes them from the store.
 func CleanupExpiredReports() {
 	StoreMu.Lock()
-	defer StoreMu.Unlock()
-
+	var removed []Report
 	now := time.Now()
 	for id, report := range Store {
 		if now.Sub(report.CreatedAt) > TTL {
@@ -32,6 +33,37 @@ func CleanupExpiredReports() {
 				log.Printf("error removing expired report file %s: %v", report.FilePath, err)
 			}
 			delete(Store, id)
+			removeFromDataset(report)
+			removed = append(removed, report)
+		}
+	}
+	StoreMu.Unlock()
+
+	notifyRemoved(removed)
+}
+
+var (
+	removeHooks   []func(Report)
+	removeHooksMu sync.Mutex
+)
+
+// OnRemove registers fn to be called for every report removed from the store,
+// so that state derived from a report can share its lifetime. Hooks run without
+// StoreMu held.
+func OnRemove(fn func(Report)) {
+	removeHooksMu.Lock()
+	defer removeHooksMu.Unlock()
+	removeHooks = append(removeHooks, fn)
+}
+
+func notifyRemoved(removed []Report) {
+	removeHooksMu.Lock()
+	hooks := slices.Clone(removeHooks)
+	removeHooksMu.Unlock()
+
+	for _, report := range removed {
+		for _, fn := range hooks {
+			fn(report)
 		}
 	}
 }
@@ -0,0 +1,99 @@
+package reports
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrVersionConflict is returned by AddVersionOn when another version was added
+// to the dataset after the one a new version was built on.
+var ErrVersionConflict = errors.New("dataset version conflict")
+
+// AddVersion registers report as the newest version of its dataset and stores it.
+// The assigned version number is returned on the stored copy.
+func AddVersion(report Report) Report {
+	StoreMu.Lock()
+	defer StoreMu.Unlock()
+	return addVersion(report)
+}
+
+// AddVersionOn is AddVersion for a version derived from the report baseID, such
+// as an append to it. It fails with ErrVersionConflict unless baseID is still
+// the latest version of the dataset, so that concurrent appends cannot drop
+// each other's rows.
+func AddVersionOn(report Report, baseID string) (Report, error) {
+	StoreMu.Lock()
+	defer StoreMu.Unlock()
+
+	ids := Datasets[report.DatasetID]
+	if len(ids) == 0 || ids[len(ids)-1] != baseID {
+		return Report{}, ErrVersionConflict
+	}
+	return addVersion(report), nil
+}
+
+// addVersion stores report as the newest version of its dataset. The caller
+// must hold StoreMu.
+func addVersion(report Report) Report {
+	ids := Datasets[report.DatasetID]
+	report.Version = 1
+	if len(ids) > 0 {
+		report.Version = Store[ids[len(ids)-1]].Version + 1
+	}
+	Datasets[report.DatasetID] = append(ids, report.ID)
+	Store[report.ID] = report
+	return report
+}
+
+// ListVersions returns all stored versions of a dataset, oldest first.
+func ListVersions(datasetID string) ([]Report, bool) {
+	StoreMu.RLock()
+	defer StoreMu.RUnlock()
+
+	ids, ok := Datasets[datasetID]
+	if !ok {
+		return nil, false
+	}
+	versions := make([]Report, 0, len(ids))
+	for _, id := range ids {
+		versions = append(versions, Store[id])
+	}
+	return versions, true
+}
+
+// LatestVersion returns the most recent version of a dataset.
+func LatestVersion(datasetID string) (Report, bool) {
+	StoreMu.RLock()
+	defer StoreMu.RUnlock()
+
+	ids := Datasets[datasetID]
+	if len(ids) == 0 {
+		return Report{}, false
+	}
+	return Store[ids[len(ids)-1]], true
+}
+
+// GetVersion returns a specific version of a dataset.
+func GetVersion(datasetID string, version int) (Report, bool) {
+	StoreMu.RLock()
+	defer StoreMu.RUnlock()
+
+	for _, id := range Datasets[datasetID] {
+		if r := Store[id]; r.Version == version {
+			return r, true
+		}
+	}
+	return Report{}, false
+}
+
+// removeFromDataset drops a report ID from its dataset's version list.
+// The caller must hold StoreMu.
+func removeFromDataset(report Report) {
+	ids := Datasets[report.DatasetID]
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == report.ID })
+	if len(ids) == 0 {
+		delete(Datasets, report.DatasetID)
+		return
+	}
+	Datasets[report.DatasetID] = ids
+}
@@ -0,0 +1,25 @@
+package reports
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddVersionOn(t *testing.T) {
+	ClearStore()
+	defer ClearStore()
+	base := AddVersion(Report{ID: "v1", DatasetID: "ds"})
+
+	// Two appends built on the same version: the second must not replace the
+	// first one's rows.
+	first, err := AddVersionOn(Report{ID: "v2", DatasetID: "ds"}, base.ID)
+	if err != nil || first.Version != 2 {
+		t.Fatalf("expected version 2, got %+v, %v", first, err)
+	}
+	if _, err := AddVersionOn(Report{ID: "v3", DatasetID: "ds"}, base.ID); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict, got %v", err)
+	}
+	if latest, _ := LatestVersion("ds"); latest.ID != "v2" {
+		t.Errorf("expected v2 to stay the latest version, got %s", latest.ID)
+	}
+}
@@ -3,6 +3,8 @@ package reports
 import (
 	"sync"
 	"time"
+
+	"erp-export-analytics/api/internal/csvutil"
 )
 
 // Report represents a metadata entry for an uploaded CSV file.
@@ -10,12 +12,23 @@ type Report struct {
 	ID        string
 	FilePath  string
 	CreatedAt time.Time
+	// DatasetID groups successive uploads of the same logical dataset.
+	DatasetID string
+	// Version is the 1-based position of this report within its dataset.
+	Version  int
+	FileName string
+	Columns  []string
+	Rows     int
+	// RowIndex locates data rows in FilePath for paginated browsing.
+	RowIndex *csvutil.RowIndex
 }
 
 var (
 	// Store is an in-memory map of report metadata, keyed by report ID.
 	Store = make(map[string]Report)
-	// StoreMu protects concurrent access to the Store.
+	// Datasets maps a dataset ID to the IDs of its report versions, oldest first.
+	Datasets = make(map[string][]string)
+	// StoreMu protects concurrent access to the Store and Datasets.
 	StoreMu sync.RWMutex
 	// TTL defines the duration after which an uploaded report is considered expired.
 	TTL = 1 * time.Hour
@@ -31,8 +44,15 @@ func SetTTL(ttl time.Duration) {
 // ClearStore removes all entries from the report store.
 func ClearStore() {
 	StoreMu.Lock()
-	defer StoreMu.Unlock()
+	removed := make([]Report, 0, len(Store))
+	for _, report := range Store {
+		removed = append(removed, report)
+	}
 	Store = make(map[string]Report)
+	Datasets = make(map[string][]string)
+	StoreMu.Unlock()
+
+	notifyRemoved(removed)
 }
 
 // GetReport retrieves a report by its ID from the store.
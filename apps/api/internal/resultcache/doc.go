@@ -0,0 +1,5 @@
+// Package resultcache keeps the results of recent report runs, keyed by report
+// ID and a canonical form of the request, so identical requests are answered
+// without scanning the file again. It evicts the least recently used results
+// beyond a size budget and drops the results of a report once it is removed.
+package resultcache
@@ -0,0 +1,239 @@
+package resultcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/reports"
+)
+
+// MaxBytes is the approximate memory budget of the cached results.
+var MaxBytes int64 = 64 << 20
+
+// Stats counts cache lookups and describes the current contents.
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"maxBytes"`
+}
+
+// entry is a cached result and the reports it was computed from.
+type entry struct {
+	key       string
+	reportIDs []string
+	resp      engine.ReportResponse
+	size      int64
+}
+
+var (
+	// lru orders entries from most to least recently used.
+	lru = list.New()
+	// entries indexes the elements of lru by key.
+	entries = make(map[string]*list.Element)
+	// byReport lists the keys of the entries that read each report.
+	byReport = make(map[string]map[string]bool)
+	stats    Stats
+	// generation counts the calls of RemoveReport and Clear.
+	generation uint64
+	// mu protects the cache state above.
+	mu        sync.Mutex
+	startOnce sync.Once
+)
+
+// Start ties cached results to the lifetime of their reports, so that removing
+// a report drops every result that read it. It is safe to call more than once;
+// only the first call has an effect.
+func Start() {
+	startOnce.Do(func() {
+		reports.OnRemove(func(r reports.Report) { RemoveReport(r.ID) })
+	})
+}
+
+// Get returns the cached result of req against reportID. The result is shared
+// and must not be modified.
+func Get(reportID string, req engine.ReportRequest) (engine.ReportResponse, bool) {
+	key, ok := requestKey(reportID, req)
+	mu.Lock()
+	defer mu.Unlock()
+	if ok {
+		if el, found := entries[key]; found {
+			lru.MoveToFront(el)
+			stats.Hits++
+			return el.Value.(*entry).resp, true
+		}
+	}
+	stats.Misses++
+	return engine.ReportResponse{}, false
+}
+
+// Generation returns the number of report removals so far. Callers take it
+// before computing a result and pass it to Put.
+func Generation() uint64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return generation
+}
+
+// Put caches the result of req against reportID. It is dropped when reportID,
+// or a report joined or used for currency conversion by req, is removed once
+// Start has been called.
+// Results larger than MaxBytes are not cached, and neither are results
+// computed while a report was removed, that is since generation gen, as they
+// may have read a report whose results were dropped already.
+func Put(reportID string, req engine.ReportRequest, resp engine.ReportResponse, gen uint64) {
+	key, ok := requestKey(reportID, req)
+	size := responseSize(resp)
+	if !ok || size > MaxBytes {
+		return
+	}
+	reportIDs := []string{reportID}
+	for _, j := range req.Joins {
+		reportIDs = append(reportIDs, j.ReportID)
+	}
+	if req.Currency != nil {
+		reportIDs = append(reportIDs, req.Currency.FXReportID)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gen != generation {
+		return
+	}
+	if el, found := entries[key]; found {
+		remove(el)
+	}
+	entries[key] = lru.PushFront(&entry{key: key, reportIDs: reportIDs, resp: resp, size: size})
+	for _, id := range reportIDs {
+		if byReport[id] == nil {
+			byReport[id] = make(map[string]bool)
+		}
+		byReport[id][key] = true
+	}
+	stats.Bytes += size
+	for stats.Bytes > MaxBytes {
+		remove(lru.Back())
+		stats.Evictions++
+	}
+}
+
+// RemoveReport drops every cached result that read reportID.
+func RemoveReport(reportID string) {
+	mu.Lock()
+	defer mu.Unlock()
+	generation++
+	for key := range byReport[reportID] {
+		remove(entries[key])
+	}
+}
+
+// GetStats returns the lookup counters and the size of the cache.
+func GetStats() Stats {
+	mu.Lock()
+	defer mu.Unlock()
+	s := stats
+	s.Entries = lru.Len()
+	s.MaxBytes = MaxBytes
+	return s
+}
+
+// Clear empties the cache and resets its counters.
+func Clear() {
+	mu.Lock()
+	defer mu.Unlock()
+	lru.Init()
+	entries = make(map[string]*list.Element)
+	byReport = make(map[string]map[string]bool)
+	stats = Stats{}
+	generation++
+}
+
+// remove deletes an element from the cache. mu must be held.
+func remove(el *list.Element) {
+	e := lru.Remove(el).(*entry)
+	delete(entries, e.key)
+	for _, id := range e.reportIDs {
+		delete(byReport[id], e.key)
+		if len(byReport[id]) == 0 {
+			delete(byReport, id)
+		}
+	}
+	stats.Bytes -= e.size
+}
+
+// requestKey returns the cache key of req against reportID: the report ID and
+// a hash of the request's canonical JSON form, in which object keys are sorted
+// and null or empty values left out, so that requests differing only in
+// field order or omitted fields share a key.
+func requestKey(reportID string, req engine.ReportRequest) (string, bool) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", false
+	}
+	if data, err = json.Marshal(canonical(v)); err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(data)
+	return reportID + ":" + hex.EncodeToString(sum[:]), true
+}
+
+// canonical drops null values and empty arrays and objects from a decoded JSON
+// value. encoding/json already sorts object keys when marshalling maps.
+func canonical(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if field = canonical(field); empty(field) {
+				delete(v, k)
+			} else {
+				v[k] = field
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = canonical(item)
+		}
+	}
+	return v
+}
+
+func empty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// responseSize estimates the memory held by a cached response.
+func responseSize(resp engine.ReportResponse) int64 {
+	const stringHeader = 16
+	size := int64(len(resp.Currency))
+	for _, c := range resp.Columns {
+		size += stringHeader + int64(len(c))
+	}
+	for _, row := range resp.Rows {
+		size += 24
+		for _, cell := range row {
+			size += stringHeader + int64(len(cell))
+		}
+	}
+	for _, m := range resp.MissingRates {
+		size += 2*stringHeader + 8 + int64(len(m.Currency)+len(m.Date))
+	}
+	return size
+}
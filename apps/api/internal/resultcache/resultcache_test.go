@@ -0,0 +1,92 @@
+package resultcache
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"erp-export-analytics/api/internal/engine"
+	"erp-export-analytics/api/internal/reports"
+)
+
+func TestResultCache(t *testing.T) {
+	Start()
+	defer Clear()
+
+	req := engine.ReportRequest{GroupBy: []string{"status"}, Metrics: []engine.Metric{{Op: "count"}}}
+	resp := engine.ReportResponse{Columns: []string{"status", "count"}, Rows: [][]string{{"paid", "3"}}, RowsScanned: 3}
+
+	t.Run("hit for an equivalent request", func(t *testing.T) {
+		Clear()
+		Put("report-1", req, resp, Generation())
+
+		var decoded engine.ReportRequest
+		body := `{"metrics":[{"op":"count"}],"filters":[],"joins":null,"groupBy":["status"],"limit":0}`
+		if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := Get("report-1", decoded); !ok || got.RowsScanned != 3 {
+			t.Errorf("expected a hit, got %v %+v", ok, got)
+		}
+		if _, ok := Get("report-2", req); ok {
+			t.Error("expected a miss for another report")
+		}
+		limited := req
+		limited.Limit = 1
+		if _, ok := Get("report-1", limited); ok {
+			t.Error("expected a miss for another request")
+		}
+		if s := GetStats(); s.Hits != 1 || s.Misses != 2 || s.Entries != 1 || s.Bytes != responseSize(resp) {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		Clear()
+		defer func(max int64) { MaxBytes = max }(MaxBytes)
+		MaxBytes = 2 * responseSize(resp)
+
+		Put("report-1", req, resp, Generation())
+		Put("report-2", req, resp, Generation())
+		Get("report-1", req)
+		Put("report-3", req, resp, Generation())
+
+		if _, ok := Get("report-2", req); ok {
+			t.Error("expected report-2 to be evicted")
+		}
+		if _, ok := Get("report-1", req); !ok {
+			t.Error("expected recently used report-1 to be kept")
+		}
+		if s := GetStats(); s.Evictions != 1 || s.Entries != 2 || s.Bytes > MaxBytes {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("invalidated with a report it read", func(t *testing.T) {
+		Clear()
+		reports.ClearStore()
+		reports.SaveReport(reports.Report{ID: "fx", CreatedAt: time.Now()})
+		converted := req
+		converted.Currency = &engine.CurrencyConversion{FXReportID: "fx", Target: "USD"}
+		Put("report-1", converted, resp, Generation())
+		Put("report-1", req, resp, Generation())
+
+		reports.ClearStore()
+		if _, ok := Get("report-1", converted); ok {
+			t.Error("expected the result using the removed fx table to be dropped")
+		}
+		if _, ok := Get("report-1", req); !ok {
+			t.Error("expected the unrelated result to be kept")
+		}
+	})
+
+	t.Run("not cached when a report is removed during the run", func(t *testing.T) {
+		Clear()
+		gen := Generation()
+		RemoveReport("report-1")
+		Put("report-1", req, resp, gen)
+		if _, ok := Get("report-1", req); ok {
+			t.Error("expected the result computed across a removal not to be cached")
+		}
+	})
+}
@@ -3,13 +3,19 @@ package main
 import (
 	"log"
 	"net/http"
+	"runtime"
 
 	"erp-export-analytics/api/internal/httpapi"
+	"erp-export-analytics/api/internal/jobs"
 	"erp-export-analytics/api/internal/reports"
+	"erp-export-analytics/api/internal/resultcache"
 )
 
 func main() {
 	reports.StartCleanupWorker()
+	jobs.Start(runtime.NumCPU())
+	resultcache.Start()
+	httpapi.StartColumnCacheCleanup()
 
 	mux := httpapi.NewRouter()
 